@@ -0,0 +1,249 @@
+//  Copyright 2013 Thomas McGrew
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package mzlib
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Represents an ion species formed from a neutral molecule M, such as
+// [M+H]+ or [2M+Na]+. Delta holds the atoms added to or lost from the
+// Multimer molecules.
+type Adduct struct {
+	Name     string
+	Multimer int
+	Delta    Formula
+	Charge   int
+}
+
+// The common adducts and in-source fragments in positive and negative mode
+var Adducts = mustParseAdducts(
+	"[M]+", "[M+H]+", "[M+NH4]+", "[M+Na]+", "[M+K]+", "[M+H-H2O]+",
+	"[M+H-2H2O]+", "[M+H-NH3]+", "[M+ACN+H]+", "[M+CH3OH+H]+",
+	"[M+2H]2+", "[M+3H]3+", "[M+H+Na]2+", "[M+H+NH4]2+", "[M+2Na]2+",
+	"[2M+H]+", "[2M+NH4]+", "[2M+Na]+", "[2M+K]+",
+	"[M]-", "[M-H]-", "[M+Cl]-", "[M+FA-H]-", "[M+Hac-H]-", "[M-H2O-H]-",
+	"[M+Na-2H]-", "[M-2H]2-", "[M-3H]3-", "[2M-H]-", "[2M+FA-H]-")
+
+// Abbreviations of common solvents and modifiers in adduct names
+var adductAbbreviations = map[string]string{
+	"ACN":  "C2H3N",
+	"FA":   "CH2O2",
+	"Hac":  "C2H4O2",
+	"TFA":  "C2HF3O2",
+	"MeOH": "CH4O",
+	"DMSO": "C2H6OS",
+}
+
+var adductPattern = regexp.MustCompile(
+	`^\[(\d*)M((?:[+-][^+\-\]]+)*)\](\d*)([+-]+)$`)
+var adductTermPattern = regexp.MustCompile(`([+-])(\d*)([^+-]+)`)
+
+// Parses an adduct name, such as "[M+H]+", "[2M+Na]+", "[M+2H]2+",
+// "[M+H-H2O]+" or "[M+FA-H]-". The abbreviations ACN, FA, Hac, TFA, MeOH
+// and DMSO may be used for common solvents and modifiers.
+//
+// Parameters:
+//   name: The name of the adduct
+//
+// Return values:
+//   Adduct: The adduct
+//   error: An error if the name could not be parsed
+func ParseAdduct(name string) (Adduct, error) {
+	a := Adduct{Name: name, Multimer: 1,
+		Delta: Formula{Atoms: make(map[string]int)}}
+	match := adductPattern.FindStringSubmatch(strings.TrimSpace(name))
+	if match == nil {
+		return a, errors.New(fmt.Sprintf("Invalid adduct '%s'", name))
+	}
+	if match[1] != "" {
+		a.Multimer, _ = strconv.Atoi(match[1])
+	}
+	for _, term := range adductTermPattern.FindAllStringSubmatch(match[2], -1) {
+		count := 1
+		if term[2] != "" {
+			count, _ = strconv.Atoi(term[2])
+		}
+		if term[1] == "-" {
+			count = -count
+		}
+		formula := term[3]
+		if abbreviation, ok := adductAbbreviations[formula]; ok {
+			formula = abbreviation
+		}
+		f, err := ParseFormula(formula)
+		if err != nil || f.Charge != 0 {
+			return a, errors.New(fmt.Sprintf("Invalid adduct '%s': %s", name,
+				term[0]))
+		}
+		a.Delta = a.Delta.Add(f.Multiply(count))
+	}
+	a.Charge = len(match[4])
+	if match[3] != "" {
+		a.Charge, _ = strconv.Atoi(match[3])
+	}
+	if match[4][0] == '-' {
+		a.Charge = -a.Charge
+	}
+	return a, nil
+}
+
+// Finds an adduct in Adducts by name
+//
+// Parameters:
+//   name: The name of the adduct, such as "[M+H]+"
+//
+// Return values:
+//   Adduct: The adduct
+//   error: An error if the adduct is not in Adducts
+func FindAdduct(name string) (Adduct, error) {
+	for _, a := range Adducts {
+		if a.Name == name {
+			return a, nil
+		}
+	}
+	return Adduct{}, errors.New(fmt.Sprintf("Adduct '%s' Not Found", name))
+}
+
+// Returns the mass added to the Multimer molecules by the adduct, including
+// the electrons of the charge.
+func (a Adduct) MassShift() float64 {
+	return a.Delta.MonoisotopicMass() - float64(a.Charge)*ElectronMass
+}
+
+// Calculates the m/z value of the adduct of a molecule
+//
+// Parameters:
+//   neutralMass: The monoisotopic mass of the neutral molecule
+//
+// Return value:
+//   float64: The m/z value of the ion
+func (a Adduct) Mz(neutralMass float64) float64 {
+	return formulaMz(float64(a.Multimer)*neutralMass+a.MassShift(), a.Charge)
+}
+
+// Calculates the mass of the neutral molecule from the m/z value of its
+// adduct
+//
+// Parameters:
+//   mz: The m/z value of the ion
+//
+// Return value:
+//   float64: The monoisotopic mass of the neutral molecule
+func (a Adduct) NeutralMass(mz float64) float64 {
+	charge := math.Abs(float64(a.Charge))
+	if charge == 0 {
+		charge = 1
+	}
+	return (mz*charge - a.MassShift()) / float64(a.Multimer)
+}
+
+// Returns the formula of the adduct of a molecule
+//
+// Parameters:
+//   molecule: The formula of the neutral molecule
+//
+// Return value:
+//   Formula: The formula of the ion, including its charge
+func (a Adduct) Ion(molecule Formula) Formula {
+	ion := molecule.Multiply(a.Multimer).Add(a.Delta)
+	ion.Charge = a.Charge
+	return ion
+}
+
+// A pair of peaks in a scan which may be different adducts of the same
+// molecule
+type AdductAnnotation struct {
+	Index       int
+	OtherIndex  int
+	Adduct      Adduct
+	OtherAdduct Adduct
+	NeutralMass float64
+}
+
+// Finds pairs of peaks in the scan which may be different adducts of the
+// same molecule, where the neutral masses calculated for each are within
+// the tolerance. Only adducts with the polarity of the scan are used, unless
+// the polarity is 0.
+//
+// Parameters:
+//   adducts: The adducts to consider, such as Adducts
+//   tolerance: The tolerance for matching the neutral masses
+//
+// Return value:
+//   []AdductAnnotation: The possible relationships, in order of the peaks
+func (s *Scan) AnnotateAdducts(adducts []Adduct,
+	tolerance Tolerance) []AdductAnnotation {
+	type candidate struct {
+		mass   float64
+		peak   int
+		adduct int
+	}
+	candidates := make([]candidate, 0, len(s.MzArray)*len(adducts))
+	for i, mz := range s.MzArray {
+		for j, a := range adducts {
+			if s.Polarity != 0 && a.Charge*int(s.Polarity) <= 0 {
+				continue
+			}
+			candidates = append(candidates, candidate{a.NeutralMass(mz), i, j})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].mass < candidates[j].mass
+	})
+	annotations := make([]AdductAnnotation, 0)
+	for i, c := range candidates {
+		_, maxMass := tolerance.Range(c.mass)
+		for j := i + 1; j < len(candidates) &&
+			candidates[j].mass <= maxMass; j++ {
+			d := candidates[j]
+			if d.peak == c.peak || d.adduct == c.adduct {
+				continue
+			}
+			if d.peak < c.peak {
+				c, d = d, c
+			}
+			annotations = append(annotations, AdductAnnotation{c.peak, d.peak,
+				adducts[c.adduct], adducts[d.adduct], (c.mass + d.mass) / 2})
+			c = candidates[i]
+		}
+	}
+	sort.SliceStable(annotations, func(i, j int) bool {
+		if annotations[i].Index != annotations[j].Index {
+			return annotations[i].Index < annotations[j].Index
+		}
+		return annotations[i].OtherIndex < annotations[j].OtherIndex
+	})
+	return annotations
+}
+
+// Parses a list of adduct names, panicking if any are invalid
+func mustParseAdducts(names ...string) []Adduct {
+	adducts := make([]Adduct, len(names))
+	for i, name := range names {
+		a, err := ParseAdduct(name)
+		if err != nil {
+			panic(err)
+		}
+		adducts[i] = a
+	}
+	return adducts
+}
@@ -0,0 +1,446 @@
+//  Copyright 2013 Thomas McGrew
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package mzlib
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Represents a warping of retention times, as a piecewise linear function
+// from the Times of a run to the Aligned times of a reference run. Both
+// Times and Aligned are strictly increasing. Times outside the range of the
+// transform are shifted by the offset at the nearest end.
+type RetentionTimeTransform struct {
+	Times   []float64
+	Aligned []float64
+}
+
+// Creates a copy of this RetentionTimeTransform
+func (t *RetentionTimeTransform) Clone() *RetentionTimeTransform {
+	cpy := new(RetentionTimeTransform)
+	cpy.Times = make([]float64, len(t.Times))
+	copy(cpy.Times, t.Times)
+	cpy.Aligned = make([]float64, len(t.Aligned))
+	copy(cpy.Aligned, t.Aligned)
+	return cpy
+}
+
+// Transforms a retention time
+//
+// Parameters:
+//   retentionTime: The retention time to transform
+//
+// Return value:
+//   float64: The aligned retention time
+func (t *RetentionTimeTransform) Apply(retentionTime float64) float64 {
+	return interpolate(t.Times, t.Aligned, retentionTime)
+}
+
+// Creates the inverse of the transform, which maps aligned retention times
+// back to the original retention times.
+//
+// Return value:
+//   RetentionTimeTransform: The inverse transform
+func (t *RetentionTimeTransform) Invert() RetentionTimeTransform {
+	inverse := t.Clone()
+	inverse.Times, inverse.Aligned = inverse.Aligned, inverse.Times
+	return *inverse
+}
+
+// Creates a transform which applies this transform followed by another.
+//
+// Parameters:
+//   next: The transform to apply after this one
+//
+// Return value:
+//   RetentionTimeTransform: The combined transform
+func (t *RetentionTimeTransform) Then(
+	next *RetentionTimeTransform) RetentionTimeTransform {
+	inverse := t.Invert()
+	times := make([]float64, 0, len(t.Times)+len(next.Times))
+	times = append(times, t.Times...)
+	for _, v := range next.Times {
+		times = append(times, inverse.Apply(v))
+	}
+	sort.Float64s(times)
+	aligned := make([]float64, len(times))
+	for i, v := range times {
+		aligned[i] = next.Apply(t.Apply(v))
+	}
+	return newRetentionTimeTransform(times, aligned)
+}
+
+// Aligns the retention times of the scans and chromatograms in the data. The
+// transform is stored in Alignment, combined with any previous alignment,
+// so the alignment can be reversed by Unalign.
+//
+// Parameters:
+//   transform: The transform to apply
+func (r *RawData) Align(transform RetentionTimeTransform) {
+	for i := range r.Scans {
+		r.Scans[i].RetentionTime = transform.Apply(r.Scans[i].RetentionTime)
+	}
+	for i := range r.Chromatograms {
+		for j, v := range r.Chromatograms[i].TimeArray {
+			r.Chromatograms[i].TimeArray[j] = transform.Apply(v)
+		}
+	}
+	if r.Alignment == nil {
+		r.Alignment = transform.Clone()
+	} else {
+		combined := r.Alignment.Then(&transform)
+		r.Alignment = &combined
+	}
+}
+
+// Restores the original retention times of aligned data, and removes the
+// Alignment.
+func (r *RawData) Unalign() {
+	if r.Alignment == nil {
+		return
+	}
+	inverse := r.Alignment.Invert()
+	for i := range r.Scans {
+		r.Scans[i].RetentionTime = inverse.Apply(r.Scans[i].RetentionTime)
+	}
+	for i := range r.Chromatograms {
+		for j, v := range r.Chromatograms[i].TimeArray {
+			r.Chromatograms[i].TimeArray[j] = inverse.Apply(v)
+		}
+	}
+	r.Alignment = nil
+}
+
+// Estimates the retention time transform between two chromatograms, such
+// as total ion chromatograms of two runs, using dynamic time warping. The
+// intensities of each chromatogram are scaled to a total of 1 before
+// matching.
+//
+// Parameters:
+//   reference: The chromatogram of the reference run
+//   sample: The chromatogram of the run to be aligned
+//   band: The maximum distance in points from the diagonal of the warping
+//     path, or 0 for no limit. Only the band of the cost matrix is stored,
+//     so a small band also limits the memory used.
+//
+// Return value:
+//   RetentionTimeTransform: The transform from the sample retention times to
+//     the reference retention times
+func DtwAlignment(reference *Chromatogram, sample *Chromatogram,
+	band int) RetentionTimeTransform {
+	a := normalizedIntensity(reference.IntensityArray)
+	b := normalizedIntensity(sample.IntensityArray)
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return RetentionTimeTransform{}
+	}
+	if band <= 0 {
+		band = n + m
+	}
+	if diff := n - m; band < diff || band < -diff {
+		// the band must reach the corner of the cost matrix
+		band = int(math.Abs(float64(diff)))
+	}
+	// only the cells within the band around the diagonal are stored, with
+	// the first cell of each row at its offset
+	width := 2*band + 1
+	if band >= m-1 {
+		width = m
+	}
+	offsets := make([]int, n)
+	cost := make([][]float64, n)
+	at := func(i int, j int) float64 {
+		k := j - offsets[i]
+		if k < 0 || k >= width {
+			return math.Inf(1)
+		}
+		return cost[i][k]
+	}
+	for i := 0; i < n; i++ {
+		if width < m {
+			// the diagonal of a non-square matrix
+			center := i * (m - 1) / int(math.Max(float64(n-1), 1))
+			offsets[i] = center - band
+		}
+		cost[i] = make([]float64, width)
+		for k := range cost[i] {
+			j := offsets[i] + k
+			if j < 0 || j >= m {
+				cost[i][k] = math.Inf(1)
+				continue
+			}
+			best := 0.0
+			if i > 0 || j > 0 {
+				best = math.Inf(1)
+				if i > 0 {
+					best = math.Min(best, at(i-1, j))
+				}
+				if j > 0 {
+					best = math.Min(best, at(i, j-1))
+				}
+				if i > 0 && j > 0 {
+					best = math.Min(best, at(i-1, j-1))
+				}
+			}
+			cost[i][k] = best + math.Abs(a[i]-b[j])
+		}
+	}
+	// trace the warping path back from the end, averaging the reference
+	// times matched to each sample point
+	sums := make([]float64, m)
+	counts := make([]float64, m)
+	i, j := n-1, m-1
+	for {
+		sums[j] += reference.TimeArray[i]
+		counts[j]++
+		if i == 0 && j == 0 {
+			break
+		}
+		switch {
+		case i == 0:
+			j--
+		case j == 0:
+			i--
+		default:
+			diagonal, up, left := at(i-1, j-1), at(i-1, j), at(i, j-1)
+			if diagonal <= up && diagonal <= left {
+				i--
+				j--
+			} else if up <= left {
+				i--
+			} else {
+				j--
+			}
+		}
+	}
+	aligned := make([]float64, m)
+	for k := range aligned {
+		aligned[k] = sums[k] / counts[k]
+	}
+	return newRetentionTimeTransform(sample.TimeArray, aligned)
+}
+
+// Estimates the retention time transform between two runs from features
+// found in both, such as the results of FindFeatures, using a locally
+// weighted regression (LOWESS) of the retention time differences.
+//
+// Parameters:
+//   reference: The features of the reference run
+//   sample: The features of the run to be aligned
+//   tolerance: The m/z tolerance for matching features
+//   maxShift: The maximum retention time difference of matching features
+//   span: The fraction of the matched features used for each local
+//     regression, typically 0.2 to 0.5
+//
+// Return values:
+//   RetentionTimeTransform: The transform from the sample retention times to
+//     the reference retention times
+//   error: An error if too few features could be matched
+func LowessAlignment(reference []Feature, sample []Feature,
+	tolerance Tolerance, maxShift float64,
+	span float64) (RetentionTimeTransform, error) {
+	x, y := matchFeatures(reference, sample, tolerance, maxShift)
+	if len(x) < 3 {
+		return RetentionTimeTransform{}, errors.New(fmt.Sprintf(
+			"Only %d features could be matched", len(x)))
+	}
+	delta := make([]float64, len(x))
+	for i := range x {
+		delta[i] = y[i] - x[i]
+	}
+	smoothed := lowess(x, delta, span, 2)
+	aligned := make([]float64, len(x))
+	for i := range x {
+		aligned[i] = x[i] + smoothed[i]
+	}
+	return newRetentionTimeTransform(x, aligned), nil
+}
+
+// Matches each sample feature to the reference feature within the tolerance
+// and maximum shift with the closest retention time, keeping only matches
+// which are also the closest sample feature to the reference feature.
+//
+// Return values:
+//   []float64: The sample retention times of the matches, sorted
+//   []float64: The reference retention times of the matches
+func matchFeatures(reference []Feature, sample []Feature, tolerance Tolerance,
+	maxShift float64) ([]float64, []float64) {
+	closest := func(f *Feature, features []Feature) int {
+		best := -1
+		for i := range features {
+			g := &features[i]
+			if !tolerance.Matches(f.Mz, g.Mz) || (f.Charge != 0 &&
+				g.Charge != 0 && f.Charge != g.Charge) ||
+				math.Abs(g.RetentionTime-f.RetentionTime) > maxShift {
+				continue
+			}
+			if best < 0 || math.Abs(g.RetentionTime-f.RetentionTime) <
+				math.Abs(features[best].RetentionTime-f.RetentionTime) {
+				best = i
+			}
+		}
+		return best
+	}
+	type match struct{ x, y float64 }
+	matches := make([]match, 0)
+	for i := range sample {
+		j := closest(&sample[i], reference)
+		if j >= 0 && closest(&reference[j], sample) == i {
+			matches = append(matches,
+				match{sample[i].RetentionTime, reference[j].RetentionTime})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].x < matches[j].x
+	})
+	x := make([]float64, len(matches))
+	y := make([]float64, len(matches))
+	for i, v := range matches {
+		x[i], y[i] = v.x, v.y
+	}
+	return x, y
+}
+
+// Smooths y as a function of x by locally weighted linear regression with
+// tricube weights and bisquare robustness iterations.
+//
+// Parameters:
+//   x: The x values, sorted
+//   y: The y values
+//   span: The fraction of the points used for each regression
+//   iterations: The number of robustness iterations
+//
+// Return value:
+//   []float64: The smoothed y values
+func lowess(x []float64, y []float64, span float64,
+	iterations int) []float64 {
+	n := len(x)
+	k := int(math.Ceil(span * float64(n)))
+	if k < 2 {
+		k = 2
+	}
+	if k > n {
+		k = n
+	}
+	robustness := make([]float64, n)
+	for i := range robustness {
+		robustness[i] = 1
+	}
+	smoothed := make([]float64, n)
+	for iteration := 0; iteration <= iterations; iteration++ {
+		start := 0
+		for i := range x {
+			// slide the window of the k nearest points
+			for start+k < n && x[i]-x[start] > x[start+k]-x[i] {
+				start++
+			}
+			width := math.Max(x[i]-x[start], x[start+k-1]-x[i]) * 1.000001
+			var sw, swx, swy, swxx, swxy float64
+			for j := start; j < start+k; j++ {
+				w := robustness[j]
+				if width > 0 {
+					d := math.Abs(x[j]-x[i]) / width
+					w *= math.Pow(1-d*d*d, 3)
+				}
+				sw += w
+				swx += w * x[j]
+				swy += w * y[j]
+				swxx += w * x[j] * x[j]
+				swxy += w * x[j] * y[j]
+			}
+			if sw <= 0 {
+				smoothed[i] = y[i]
+				continue
+			}
+			denominator := sw*swxx - swx*swx
+			if math.Abs(denominator) < 1e-12*sw*sw {
+				smoothed[i] = swy / sw
+			} else {
+				slope := (sw*swxy - swx*swy) / denominator
+				smoothed[i] = (swy-slope*swx)/sw + slope*x[i]
+			}
+		}
+		if iteration == iterations {
+			break
+		}
+		residuals := make([]float64, n)
+		for i := range residuals {
+			residuals[i] = math.Abs(y[i] - smoothed[i])
+		}
+		scale := 6 * median(residuals)
+		for i := range robustness {
+			if scale <= 0 {
+				robustness[i] = 1
+			} else if u := residuals[i] / scale; u < 1 {
+				robustness[i] = (1 - u*u) * (1 - u*u)
+			} else {
+				robustness[i] = 0
+			}
+		}
+	}
+	return smoothed
+}
+
+// Creates a transform from pairs of times, dropping any pairs which would
+// keep either series from strictly increasing.
+func newRetentionTimeTransform(times []float64,
+	aligned []float64) RetentionTimeTransform {
+	t := RetentionTimeTransform{}
+	for i := range times {
+		n := len(t.Times)
+		if n > 0 && (times[i] <= t.Times[n-1] ||
+			aligned[i] <= t.Aligned[n-1]) {
+			continue
+		}
+		t.Times = append(t.Times, times[i])
+		t.Aligned = append(t.Aligned, aligned[i])
+	}
+	return t
+}
+
+// Interpolates linearly between points, shifting values outside the range
+// of the points by the offset at the nearest end.
+func interpolate(x []float64, y []float64, value float64) float64 {
+	n := len(x)
+	if n == 0 {
+		return value
+	}
+	i := sort.SearchFloat64s(x, value)
+	if i == 0 {
+		return value + y[0] - x[0]
+	}
+	if i == n {
+		return value + y[n-1] - x[n-1]
+	}
+	return y[i-1] + (y[i]-y[i-1])*(value-x[i-1])/(x[i]-x[i-1])
+}
+
+// Scales the values to a total of 1
+func normalizedIntensity(values []float64) []float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	normalized := make([]float64, len(values))
+	for i, v := range values {
+		if sum > 0 {
+			normalized[i] = v / sum
+		}
+	}
+	return normalized
+}
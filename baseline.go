@@ -0,0 +1,267 @@
+//  Copyright 2013 Thomas McGrew
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package mzlib
+
+import (
+	"math"
+)
+
+// Estimates the baseline of a signal. The returned baseline has the same
+// length as the signal.
+type Baseline func(y []float64) []float64
+
+// Creates a Baseline using a morphological top-hat filter. The baseline is
+// the opening (an erosion followed by a dilation) of the signal, which
+// removes any peaks narrower than the window.
+//
+// Parameters:
+//   window: The number of points in the structuring element. This should be
+//     wider than the widest peak.
+//
+// Return value:
+//   Baseline: The new Baseline
+func TopHatBaseline(window int) Baseline {
+	return func(y []float64) []float64 {
+		return slidingExtreme(slidingExtreme(y, window, math.Min), window,
+			math.Max)
+	}
+}
+
+// Creates a Baseline using the statistics-sensitive non-linear iterative
+// peak-clipping (SNIP) algorithm. The signal is compressed with a
+// log-log-square root transform before clipping.
+//
+// Parameters:
+//   iterations: The number of clipping iterations, which should be about
+//     half the width in points of the widest peak
+//
+// Return value:
+//   Baseline: The new Baseline
+func SnipBaseline(iterations int) Baseline {
+	return func(y []float64) []float64 {
+		v := make([]float64, len(y))
+		for i := range y {
+			v[i] = math.Log(math.Log(math.Sqrt(math.Max(y[i], 0)+1)+1) + 1)
+		}
+		clipped := make([]float64, len(v))
+		for p := 1; p <= iterations; p++ {
+			copy(clipped, v)
+			for i := p; i < len(v)-p; i++ {
+				clipped[i] = math.Min(v[i], (v[i-p]+v[i+p])/2)
+			}
+			v, clipped = clipped, v
+		}
+		for i := range v {
+			v[i] = math.Exp(math.Exp(v[i])-1) - 1
+			v[i] = v[i]*v[i] - 1
+		}
+		return v
+	}
+}
+
+// Creates a Baseline using asymmetric least squares smoothing. A smooth
+// curve is fit to the signal, with points above the curve given a weight of
+// p and points below it a weight of 1 - p.
+//
+// Parameters:
+//   lambda: The smoothness of the baseline, typically 1e2 to 1e9
+//   p: The asymmetry of the weights, typically 0.001 to 0.1
+//   iterations: The number of times the weights are updated
+//
+// Return value:
+//   Baseline: The new Baseline
+func AlsBaseline(lambda float64, p float64, iterations int) Baseline {
+	return func(y []float64) []float64 {
+		weights := make([]float64, len(y))
+		for i := range weights {
+			weights[i] = 1
+		}
+		z := make([]float64, len(y))
+		copy(z, y)
+		if len(y) < 3 {
+			return z
+		}
+		for k := 0; k < iterations; k++ {
+			z = whittakerSmooth(y, weights, lambda)
+			for i := range y {
+				if y[i] > z[i] {
+					weights[i] = p
+				} else {
+					weights[i] = 1 - p
+				}
+			}
+		}
+		return z
+	}
+}
+
+// Returns a copy of the scan with the baseline subtracted from the
+// intensity values. The baseline is also stored in a BaselineArray of the
+// copy.
+//
+// Parameters:
+//   baseline: The Baseline used to estimate the baseline
+//
+// Return values:
+//   *Scan: The corrected scan
+//   []float64: The baseline
+func (s *Scan) SubtractBaseline(baseline Baseline) (*Scan, []float64) {
+	cpy := s.Clone()
+	b := baseline(s.IntensityArray)
+	cpy.IntensityArray = subtractBaseline(s.IntensityArray, b)
+	cpy.SetExtraArray(NewDataArray(BaselineArray, b))
+	return cpy, b
+}
+
+// Returns a copy of the chromatogram with the baseline subtracted from the
+// intensity values.
+//
+// Parameters:
+//   baseline: The Baseline used to estimate the baseline
+//
+// Return values:
+//   *Chromatogram: The corrected chromatogram
+//   []float64: The baseline
+func (c *Chromatogram) SubtractBaseline(
+	baseline Baseline) (*Chromatogram, []float64) {
+	cpy := c.Clone()
+	b := baseline(c.IntensityArray)
+	cpy.IntensityArray = subtractBaseline(c.IntensityArray, b)
+	return cpy, b
+}
+
+// Returns a copy of the data with the baseline subtracted from every scan.
+// The baseline of each scan is stored in a BaselineArray. The scans are
+// processed in parallel.
+//
+// Parameters:
+//   baseline: The Baseline used to estimate the baseline
+//
+// Return value:
+//   RawData: The corrected data
+func (r *RawData) SubtractBaseline(baseline Baseline) RawData {
+	cpy := r.Clone()
+	chans := make([]chan *Scan, len(cpy.Scans))
+	for i := range cpy.Scans {
+		chans[i] = make(chan *Scan)
+		go func(s *Scan, c chan *Scan) {
+			corrected, _ := s.SubtractBaseline(baseline)
+			c <- corrected
+		}(&cpy.Scans[i], chans[i])
+	}
+	for i, c := range chans {
+		cpy.Scans[i] = *<-c
+	}
+	return cpy
+}
+
+// Subtracts a baseline from a signal, clipping negative values to 0.
+func subtractBaseline(y []float64, baseline []float64) []float64 {
+	corrected := make([]float64, len(y))
+	for i := range y {
+		corrected[i] = math.Max(y[i]-baseline[i], 0)
+	}
+	return corrected
+}
+
+// Applies a function such as math.Min or math.Max over a sliding window
+// centered on each point.
+func slidingExtreme(y []float64, window int,
+	f func(float64, float64) float64) []float64 {
+	result := make([]float64, len(y))
+	half := window / 2
+	for i := range y {
+		start, end := i-half, i+half
+		if start < 0 {
+			start = 0
+		}
+		if end > len(y)-1 {
+			end = len(y) - 1
+		}
+		result[i] = y[start]
+		for j := start + 1; j <= end; j++ {
+			result[i] = f(result[i], y[j])
+		}
+	}
+	return result
+}
+
+// Solves the weighted Whittaker smoother (W + lambda D'D) z = W y, where D is
+// the second order difference matrix, using a banded Cholesky decomposition.
+func whittakerSmooth(y []float64, weights []float64,
+	lambda float64) []float64 {
+	n := len(y)
+	// the three diagonals of the symmetric pentadiagonal matrix
+	d0 := make([]float64, n)
+	d1 := make([]float64, n)
+	d2 := make([]float64, n)
+	for i := 0; i < n-2; i++ {
+		// each row of D is [1, -2, 1] starting at column i
+		d0[i] += lambda
+		d0[i+1] += 4 * lambda
+		d0[i+2] += lambda
+		d1[i] += -2 * lambda
+		d1[i+1] += -2 * lambda
+		d2[i] += lambda
+	}
+	for i := range d0 {
+		d0[i] += weights[i]
+	}
+	// LDL' decomposition
+	l1 := make([]float64, n)
+	l2 := make([]float64, n)
+	diag := make([]float64, n)
+	for i := 0; i < n; i++ {
+		diag[i] = d0[i]
+		if i >= 1 {
+			diag[i] -= l1[i-1] * l1[i-1] * diag[i-1]
+		}
+		if i >= 2 {
+			diag[i] -= l2[i-2] * l2[i-2] * diag[i-2]
+		}
+		if i+1 < n {
+			l1[i] = d1[i]
+			if i >= 1 {
+				l1[i] -= l2[i-1] * l1[i-1] * diag[i-1]
+			}
+			l1[i] /= diag[i]
+		}
+		if i+2 < n {
+			l2[i] = d2[i] / diag[i]
+		}
+	}
+	z := make([]float64, n)
+	for i := 0; i < n; i++ {
+		z[i] = weights[i] * y[i]
+		if i >= 1 {
+			z[i] -= l1[i-1] * z[i-1]
+		}
+		if i >= 2 {
+			z[i] -= l2[i-2] * z[i-2]
+		}
+	}
+	for i := range z {
+		z[i] /= diag[i]
+	}
+	for i := n - 1; i >= 0; i-- {
+		if i+1 < n {
+			z[i] -= l1[i] * z[i+1]
+		}
+		if i+2 < n {
+			z[i] -= l2[i] * z[i+2]
+		}
+	}
+	return z
+}
@@ -0,0 +1,251 @@
+//  Copyright 2013 Thomas McGrew
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package mzlib
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+const (
+	// The ways of combining the peaks in each bin of an MzGrid.
+	BinSum int = iota
+	BinMax
+	BinInterpolate
+	// The largest number of bins in a grid created by FixedWidthGrid or
+	// PpmGrid
+	MaxGridBins int = 10000000
+)
+
+// Represents a grid of m/z bins. Bin i contains the m/z values from
+// Edges[i] up to, but not including, Edges[i+1], except that the last bin
+// also includes its upper edge. Grids are created with FixedWidthGrid,
+// PpmGrid or EdgesGrid, which check that the edges are finite and sorted.
+type MzGrid struct {
+	Edges []float64
+}
+
+// Creates an MzGrid of bins with the same width in m/z
+//
+// Parameters:
+//   minMz: The lower edge of the first bin
+//   maxMz: The upper limit of the last bin
+//   width: The width of each bin
+//
+// Return values:
+//   MzGrid: The new MzGrid
+//   error: An error if the range or width is invalid, or would create more
+//     than MaxGridBins bins
+func FixedWidthGrid(minMz float64, maxMz float64,
+	width float64) (MzGrid, error) {
+	if err := checkGridRange(minMz, maxMz); err != nil {
+		return MzGrid{}, err
+	}
+	if !(width > 0) || math.IsInf(width, 1) {
+		return MzGrid{}, errors.New(fmt.Sprintf("Invalid bin width %v", width))
+	}
+	bins := math.Ceil((maxMz - minMz) / width)
+	if bins > float64(MaxGridBins) {
+		return MzGrid{}, errors.New(fmt.Sprintf(
+			"Bin width %v creates more than %d bins", width, MaxGridBins))
+	}
+	count := int(bins)
+	edges := make([]float64, count+1)
+	for i := range edges {
+		edges[i] = minMz + float64(i)*width
+	}
+	return MzGrid{edges}, nil
+}
+
+// Creates an MzGrid of bins with the same width in parts per million of
+// their lower edge
+//
+// Parameters:
+//   minMz: The lower edge of the first bin
+//   maxMz: The upper limit of the last bin
+//   ppm: The width of each bin in parts per million
+//
+// Return values:
+//   MzGrid: The new MzGrid
+//   error: An error if the range or width is invalid, including a minMz
+//     which is not positive, or would create more than MaxGridBins bins
+func PpmGrid(minMz float64, maxMz float64, ppm float64) (MzGrid, error) {
+	if err := checkGridRange(minMz, maxMz); err != nil {
+		return MzGrid{}, err
+	}
+	if !(minMz > 0) {
+		return MzGrid{}, errors.New(fmt.Sprintf(
+			"Invalid minimum m/z %v for a ppm grid", minMz))
+	}
+	if !(ppm > 0) || math.IsInf(ppm, 1) {
+		return MzGrid{}, errors.New(fmt.Sprintf("Invalid bin width %v ppm",
+			ppm))
+	}
+	bins := math.Ceil(math.Log(maxMz/minMz) / math.Log1p(ppm*1e-6))
+	if bins > float64(MaxGridBins) {
+		return MzGrid{}, errors.New(fmt.Sprintf(
+			"Bin width %v ppm creates more than %d bins", ppm, MaxGridBins))
+	}
+	edges := make([]float64, 1, int(bins)+2)
+	edges[0] = minMz
+	for edge := minMz; edge < maxMz; {
+		next := edge * (1 + ppm*1e-6)
+		if next <= edge {
+			return MzGrid{}, errors.New(fmt.Sprintf(
+				"Bin width %v ppm is too small at m/z %v", ppm, edge))
+		}
+		edge = next
+		edges = append(edges, edge)
+	}
+	return MzGrid{edges}, nil
+}
+
+// Creates an MzGrid from the edges of its bins
+//
+// Parameters:
+//   edges: The edges of the bins in increasing order. The edges are copied.
+//
+// Return values:
+//   MzGrid: The new MzGrid
+//   error: An error if there are fewer than 2 edges, or the edges are not
+//     finite and strictly increasing
+func EdgesGrid(edges []float64) (MzGrid, error) {
+	if len(edges) < 2 {
+		return MzGrid{}, errors.New(fmt.Sprintf(
+			"A grid requires at least 2 edges, got %d", len(edges)))
+	}
+	for i, v := range edges {
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			return MzGrid{}, errors.New(fmt.Sprintf("Invalid edge %v", v))
+		}
+		if i > 0 && !(v > edges[i-1]) {
+			return MzGrid{}, errors.New(fmt.Sprintf(
+				"Edges are not in increasing order at %v", v))
+		}
+	}
+	cpy := make([]float64, len(edges))
+	copy(cpy, edges)
+	return MzGrid{cpy}, nil
+}
+
+// Checks that the m/z range of a grid is finite and not empty
+func checkGridRange(minMz float64, maxMz float64) error {
+	if math.IsInf(minMz, 0) || math.IsInf(maxMz, 0) || !(maxMz > minMz) {
+		return errors.New(fmt.Sprintf("Invalid m/z range %v to %v", minMz,
+			maxMz))
+	}
+	return nil
+}
+
+// Returns the number of bins in the grid
+func (g *MzGrid) Len() int {
+	if len(g.Edges) < 2 {
+		return 0
+	}
+	return len(g.Edges) - 1
+}
+
+// Returns the center m/z value of each bin
+//
+// Return value:
+//   []float64: The center of each bin
+func (g *MzGrid) Centers() []float64 {
+	centers := make([]float64, g.Len())
+	for i := range centers {
+		centers[i] = (g.Edges[i] + g.Edges[i+1]) / 2
+	}
+	return centers
+}
+
+// Finds the bin containing an m/z value
+//
+// Parameters:
+//   mz: The m/z value
+//
+// Return value:
+//   int: The index of the bin, or -1 if the value is outside the grid
+func (g *MzGrid) Bin(mz float64) int {
+	n := g.Len()
+	if n == 0 || mz < g.Edges[0] || mz > g.Edges[n] {
+		return -1
+	}
+	i := sort.Search(len(g.Edges), func(i int) bool {
+		return g.Edges[i] > mz
+	}) - 1
+	if i >= n {
+		i = n - 1
+	}
+	return i
+}
+
+// Resamples the scan onto an m/z grid.
+//
+// Parameters:
+//   grid: The m/z grid
+//   mode: BinSum to sum the intensities of the peaks in each bin, BinMax to
+//     use the highest intensity in each bin, or BinInterpolate to
+//     interpolate the intensity at the center of each bin, which is suited
+//     to continuous scans
+//
+// Return value:
+//   []float64: The intensity of each bin
+func (s *Scan) Bin(grid MzGrid, mode int) []float64 {
+	if mode == BinInterpolate {
+		mz, intensity := s.sortedPeaks()
+		return resample(mz, intensity, grid.Centers())
+	}
+	bins := make([]float64, grid.Len())
+	for i, v := range s.MzArray {
+		bin := grid.Bin(v)
+		if bin < 0 {
+			continue
+		}
+		if mode == BinMax {
+			bins[bin] = math.Max(bins[bin], s.IntensityArray[i])
+		} else {
+			bins[bin] += s.IntensityArray[i]
+		}
+	}
+	return bins
+}
+
+// Resamples the scans with the given ms level and polarity onto an m/z grid,
+// producing a dense matrix of intensities.
+//
+// Parameters:
+//   grid: The m/z grid
+//   mode: BinSum, BinMax or BinInterpolate, as for Scan.Bin
+//   msLevel: The ms level of the scans to include
+//   polarity: The polarity of the scans to include, or 0 for any polarity
+//
+// Return values:
+//   [][]float64: The intensities, with a row for each scan and a column for
+//     each bin
+//   []float64: The retention time of each row
+//   []float64: The center m/z value of each column
+func (r *RawData) Matrix(grid MzGrid, mode int, msLevel uint8,
+	polarity int8) ([][]float64, []float64, []float64) {
+	matrix := make([][]float64, 0, len(r.Scans))
+	times := make([]float64, 0, len(r.Scans))
+	for i := range r.Scans {
+		if r.Scans[i].matches(msLevel, polarity) {
+			matrix = append(matrix, r.Scans[i].Bin(grid, mode))
+			times = append(times, r.Scans[i].RetentionTime)
+		}
+	}
+	return matrix, times, grid.Centers()
+}
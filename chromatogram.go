@@ -0,0 +1,155 @@
+//  Copyright 2013 Thomas McGrew
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package mzlib
+
+const (
+	// PSI-MS accessions of the chromatogram types.
+	TicChromatogram string = "MS:1000235"
+	SicChromatogram string = "MS:1000627"
+	BpcChromatogram string = "MS:1000628"
+	SrmChromatogram string = "MS:1001473"
+)
+
+// Represents a chromatogram, either calculated from the scans of a RawData
+// or read from a file. For SRM/MRM transitions, PrecursorMz and ProductMz
+// hold the Q1 and Q3 m/z values. MobilityRange holds the ion mobility window
+// of a chromatogram extracted by mobility, and is not written to files.
+type Chromatogram struct {
+	Id              string
+	Type            string
+	MzRange         [2]float64
+	MobilityRange   [2]float64
+	MsLevel         uint8
+	Polarity        int8
+	PrecursorMz     float64
+	ProductMz       float64
+	CollisionEnergy float64
+	Params          Params
+	TimeArray       []float64
+	IntensityArray  []float64
+}
+
+// Creates a copy of this Chromatogram
+func (c *Chromatogram) Clone() *Chromatogram {
+	cpy := new(Chromatogram)
+	*cpy = *c
+	cpy.Params = c.Params.Clone()
+	cpy.TimeArray = make([]float64, len(c.TimeArray))
+	copy(cpy.TimeArray, c.TimeArray)
+	cpy.IntensityArray = make([]float64, len(c.IntensityArray))
+	copy(cpy.IntensityArray, c.IntensityArray)
+	return cpy
+}
+
+// Returns a total ion chromatogram for the data.
+//
+// Parameters:
+//   msLevel: The ms level of the scans to include.
+//   polarity: The polarity of the scans to include, or 0 for any polarity.
+//
+// Return value:
+//   Chromatogram: The total intensity and retention time of each scan.
+func (r *RawData) TotalIonChromatogram(msLevel uint8,
+	polarity int8) Chromatogram {
+	c := r.newChromatogram(TicChromatogram, msLevel, polarity)
+	for _, s := range r.Scans {
+		if s.matches(msLevel, polarity) {
+			c.TimeArray = append(c.TimeArray, s.RetentionTime)
+			c.IntensityArray = append(c.IntensityArray, s.TotalIntensity())
+		}
+	}
+	return c
+}
+
+// Returns an extracted ion chromatogram for the data.
+//
+// Parameters:
+//   minMz: The minimum m/z value to select peaks from (exclusive).
+//   maxMz: The maximum m/z value to select peaks from (exclusive).
+//   msLevel: The ms level of the scans to include.
+//   polarity: The polarity of the scans to include, or 0 for any polarity.
+//
+// Return value:
+//   Chromatogram: The total intensity of all peaks between minMz and maxMz
+//     and the retention time of each scan.
+func (r *RawData) ExtractedIonChromatogram(minMz float64, maxMz float64,
+	msLevel uint8, polarity int8) Chromatogram {
+	c := r.newChromatogram(SicChromatogram, msLevel, polarity)
+	c.MzRange[0], c.MzRange[1] = minMz, maxMz
+	var sum float64
+	for _, s := range r.Scans {
+		if s.matches(msLevel, polarity) {
+			sum = 0.0
+			for i, v := range s.MzArray {
+				if v > minMz && v < maxMz {
+					sum += s.IntensityArray[i]
+				}
+			}
+			c.TimeArray = append(c.TimeArray, s.RetentionTime)
+			c.IntensityArray = append(c.IntensityArray, sum)
+		}
+	}
+	return c
+}
+
+// Returns a base peak chromatogram for the data.
+//
+// Parameters:
+//   msLevel: The ms level of the scans to include.
+//   polarity: The polarity of the scans to include, or 0 for any polarity.
+//
+// Return value:
+//   Chromatogram: The intensity of the largest peak and the retention time of
+//     each scan.
+func (r *RawData) BasePeakChromatogram(msLevel uint8,
+	polarity int8) Chromatogram {
+	c := r.newChromatogram(BpcChromatogram, msLevel, polarity)
+	var val float64
+	for _, s := range r.Scans {
+		if s.matches(msLevel, polarity) {
+			val = 0.0
+			for _, v := range s.IntensityArray {
+				if v > val {
+					val = v
+				}
+			}
+			c.TimeArray = append(c.TimeArray, s.RetentionTime)
+			c.IntensityArray = append(c.IntensityArray, val)
+		}
+	}
+	return c
+}
+
+// Creates an empty chromatogram of the given type
+func (r *RawData) newChromatogram(chromatogramType string, msLevel uint8,
+	polarity int8) Chromatogram {
+	c := Chromatogram{Type: chromatogramType, MsLevel: msLevel,
+		Polarity: polarity}
+	if term, err := PsiMs.Term(chromatogramType); err == nil {
+		c.Id = term.Name
+	}
+	c.TimeArray = make([]float64, 0, r.ScanCount)
+	c.IntensityArray = make([]float64, 0, r.ScanCount)
+	return c
+}
+
+// Determines whether or not the scan has the given ms level and polarity
+//
+// Parameters:
+//   msLevel: The ms level to match.
+//   polarity: The polarity to match, or 0 to match any polarity.
+func (s *Scan) matches(msLevel uint8, polarity int8) bool {
+	return s.MsLevel == msLevel && (polarity == 0 || s.Polarity == polarity)
+}
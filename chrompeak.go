@@ -0,0 +1,189 @@
+//  Copyright 2013 Thomas McGrew
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package mzlib
+
+import (
+	"math"
+)
+
+// Represents a peak found in a chromatogram. Height and Area are measured
+// above a straight baseline drawn between the start and end of the peak.
+// Asymmetry is the ratio of the trailing to the leading half width at 10% of
+// the height, and Tailing is the USP tailing factor at 5% of the height.
+type ChromatogramPeak struct {
+	RetentionTime float64
+	StartTime     float64
+	EndTime       float64
+	Area          float64
+	Height        float64
+	Fwhm          float64
+	Asymmetry     float64
+	Tailing       float64
+	SignalToNoise float64
+	Apex          int
+	Start         int
+	End           int
+}
+
+// Finds the peaks in the chromatogram. Peaks are found at the maxima of the
+// intensity and extend in each direction until the intensity starts rising
+// again, so noisy chromatograms should be smoothed first. A maximum at the
+// first or last point is reported as a peak truncated by the end of the
+// data, measured above a flat baseline at the intensity of its other end.
+// The widths of a truncated peak cover only the side within the data, and
+// its Asymmetry and Tailing are 0.
+//
+// Parameters:
+//   minWidth: The minimum full width at half maximum of a peak, in minutes
+//   minProminence: The minimum height of a peak above the higher of the
+//     lowest points separating it from any higher peak on either side
+//
+// Return value:
+//   []ChromatogramPeak: The peaks in order of retention time
+func (c *Chromatogram) FindPeaks(minWidth float64,
+	minProminence float64) []ChromatogramPeak {
+	t, y := c.TimeArray, c.IntensityArray
+	noise := robustNoise(y) - median(y)
+	peaks := make([]ChromatogramPeak, 0)
+	for i := 0; i < len(y); i++ {
+		if i > 0 && y[i] <= y[i-1] {
+			continue
+		}
+		// include any plateau in the apex
+		top := i
+		for top+1 < len(y) && y[top+1] == y[i] {
+			top++
+		}
+		if (top+1 < len(y) && y[top+1] > y[i]) || (i == 0 && top == len(y)-1) {
+			i = top
+			continue
+		}
+		apex := (i + top) / 2
+		if peakProminence(y, i, top) < minProminence {
+			i = top
+			continue
+		}
+		p := ChromatogramPeak{Apex: apex, Start: i, End: top}
+		for p.Start > 0 && y[p.Start-1] < y[p.Start] {
+			p.Start--
+		}
+		for p.End+1 < len(y) && y[p.End+1] < y[p.End] {
+			p.End++
+		}
+		p.measure(t, y)
+		if noise > 0 {
+			p.SignalToNoise = p.Height / noise
+		} else if p.Height > 0 {
+			p.SignalToNoise = math.Inf(1)
+		}
+		if p.Fwhm >= minWidth {
+			peaks = append(peaks, p)
+		}
+		i = top
+	}
+	return peaks
+}
+
+// Calculates the retention times, height, area and shape of the peak from
+// its Apex, Start and End.
+func (p *ChromatogramPeak) measure(t []float64, y []float64) {
+	p.RetentionTime = t[p.Apex]
+	p.StartTime = t[p.Start]
+	p.EndTime = t[p.End]
+	// peaks truncated by the ends of the data have a flat baseline at the
+	// intensity of their other end
+	leftTruncated := p.Start == 0 && y[0] == y[p.Apex]
+	rightTruncated := p.End == len(y)-1 && y[p.End] == y[p.Apex]
+	baseline := func(i int) float64 {
+		if p.End == p.Start || (leftTruncated && rightTruncated) {
+			return y[p.Start]
+		} else if leftTruncated {
+			return y[p.End]
+		} else if rightTruncated {
+			return y[p.Start]
+		}
+		return y[p.Start] + (y[p.End]-y[p.Start])*(t[i]-t[p.Start])/
+			(t[p.End]-t[p.Start])
+	}
+	p.Height = y[p.Apex] - baseline(p.Apex)
+	for i := p.Start; i < p.End; i++ {
+		p.Area += (t[i+1] - t[i]) *
+			((y[i] - baseline(i)) + (y[i+1] - baseline(i+1))) / 2
+	}
+	// the leading and trailing widths at a fraction of the height
+	widths := func(fraction float64) (float64, float64) {
+		level := p.Height * fraction
+		leading, trailing := t[p.Apex]-t[p.Start], t[p.End]-t[p.Apex]
+		for i := p.Apex; i > p.Start; i-- {
+			if y[i-1]-baseline(i-1) <= level {
+				leading = t[p.Apex] - crossing(t, y, baseline, i-1, i, level)
+				break
+			}
+		}
+		for i := p.Apex; i < p.End; i++ {
+			if y[i+1]-baseline(i+1) <= level {
+				trailing = crossing(t, y, baseline, i, i+1, level) - t[p.Apex]
+				break
+			}
+		}
+		return leading, trailing
+	}
+	leading, trailing := widths(0.5)
+	p.Fwhm = leading + trailing
+	if leftTruncated || rightTruncated {
+		return
+	}
+	leading, trailing = widths(0.1)
+	if leading > 0 {
+		p.Asymmetry = trailing / leading
+	}
+	leading, trailing = widths(0.05)
+	if leading > 0 {
+		p.Tailing = (leading + trailing) / (2 * leading)
+	}
+}
+
+// Finds the time at which the intensity above the baseline crosses a level
+// between two points by linear interpolation.
+func crossing(t []float64, y []float64, baseline func(int) float64, i int,
+	j int, level float64) float64 {
+	yi, yj := y[i]-baseline(i), y[j]-baseline(j)
+	if yi == yj {
+		return t[i]
+	}
+	return t[i] + (t[j]-t[i])*(level-yi)/(yj-yi)
+}
+
+// Calculates the prominence of a maximum, which is its height above the
+// higher of the lowest points between it and the nearest higher point (or
+// the end of the data) on each side. A side with no points, for a maximum
+// at the end of the data, is ignored.
+func peakProminence(y []float64, start int, end int) float64 {
+	height := y[start]
+	leftMin := height
+	for i := start - 1; i >= 0 && y[i] <= height; i-- {
+		leftMin = math.Min(leftMin, y[i])
+	}
+	rightMin := height
+	for i := end + 1; i < len(y) && y[i] <= height; i++ {
+		rightMin = math.Min(rightMin, y[i])
+	}
+	if start == 0 {
+		return height - rightMin
+	} else if end == len(y)-1 {
+		return height - leftMin
+	}
+	return height - math.Max(leftMin, rightMin)
+}
@@ -0,0 +1,343 @@
+//  Copyright 2013 Thomas McGrew
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package mzlib
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// The controlled vocabulary used when decoding and encoding files. It is
+// loaded from a bundled subset of the PSI-MS OBO file, and may be extended
+// with the full file by calling PsiMs.ReadObo.
+var PsiMs = NewControlledVocabulary()
+
+func init() {
+	if err := PsiMs.DecodeObo(strings.NewReader(psiMsObo)); err != nil {
+		panic(err)
+	}
+}
+
+// Represents a single term from a controlled vocabulary.
+type CvTerm struct {
+	Id         string
+	Name       string
+	Def        string
+	Synonyms   []string
+	IsA        []string
+	Units      []string
+	Obsolete   bool
+	ReplacedBy []string
+}
+
+// Represents a controlled vocabulary such as PSI-MS, read from an OBO file.
+type ControlledVocabulary struct {
+	Terms map[string]*CvTerm
+	names map[string]*CvTerm
+}
+
+// Creates a new, empty controlled vocabulary.
+func NewControlledVocabulary() *ControlledVocabulary {
+	cv := new(ControlledVocabulary)
+	cv.Terms = make(map[string]*CvTerm)
+	cv.names = make(map[string]*CvTerm)
+	return cv
+}
+
+// Reads terms from an OBO file. Terms which are already present in the
+// vocabulary are replaced.
+//
+// Parameters:
+//   filename: The name of the file to read from
+//
+// Return value:
+//   error: Indicates whether or not an error occurred while reading the file
+func (cv *ControlledVocabulary) ReadObo(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return cv.DecodeObo(file)
+}
+
+// Decodes terms from a Reader containing OBO formatted data. Terms which are
+// already present in the vocabulary are replaced.
+//
+// Parameters:
+//   reader: The reader to read the terms from
+//
+// Return value:
+//   error: Indicates whether or not an error occurred when reading the data
+func (cv *ControlledVocabulary) DecodeObo(reader io.Reader) error {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	var term *CvTerm
+	inTerm := false
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '!' {
+			continue
+		}
+		if line[0] == '[' {
+			cv.add(term)
+			term = nil
+			inTerm = line == "[Term]"
+			if inTerm {
+				term = new(CvTerm)
+			}
+			continue
+		}
+		if !inTerm {
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			return errors.New(fmt.Sprintf("Invalid OBO tag on line %d", lineNo))
+		}
+		tag, value := line[:i], oboValue(line[i+1:])
+		switch tag {
+		case "id":
+			term.Id = value
+		case "name":
+			term.Name = value
+		case "def":
+			term.Def = oboQuoted(value)
+		case "synonym":
+			term.Synonyms = append(term.Synonyms, oboQuoted(value))
+		case "is_a":
+			term.IsA = append(term.IsA, value)
+		case "relationship":
+			if fields := strings.Fields(value); len(fields) >= 2 &&
+				fields[0] == "has_units" {
+				term.Units = append(term.Units, fields[1])
+			}
+		case "is_obsolete":
+			term.Obsolete = value == "true"
+		case "replaced_by":
+			term.ReplacedBy = append(term.ReplacedBy, value)
+		}
+	}
+	cv.add(term)
+	return scanner.Err()
+}
+
+// Adds a term to the vocabulary, replacing any existing term with the same id
+func (cv *ControlledVocabulary) add(term *CvTerm) {
+	if term == nil || term.Id == "" {
+		return
+	}
+	cv.Terms[term.Id] = term
+	if name := cvName(term.Name); name != "" {
+		cv.names[name] = term
+	}
+	for _, v := range term.Synonyms {
+		name := cvName(v)
+		if _, ok := cv.names[name]; !ok && name != "" {
+			cv.names[name] = term
+		}
+	}
+}
+
+// Finds a term by its accession.
+//
+// Parameters:
+//   accession: The accession of the term, e.g. "MS:1000514". Accessions
+//     using the "PSI" prefix from mzData are also accepted.
+//
+// Return values:
+//   *CvTerm: The term, or nil if not found
+//   error: An error if the term was not found
+func (cv *ControlledVocabulary) Term(accession string) (*CvTerm, error) {
+	if term, ok := cv.Terms[cvAccession(accession)]; ok {
+		return term, nil
+	}
+	return nil, errors.New(fmt.Sprintf("Term '%s' Not Found", accession))
+}
+
+// Finds a term by its name or one of its synonyms. Case, whitespace and
+// punctuation are ignored when comparing names.
+//
+// Parameters:
+//   name: The name of the term
+//
+// Return values:
+//   *CvTerm: The term, or nil if not found
+//   error: An error if the term was not found
+func (cv *ControlledVocabulary) Find(name string) (*CvTerm, error) {
+	if term, ok := cv.names[cvName(name)]; ok {
+		return term, nil
+	}
+	return nil, errors.New(fmt.Sprintf("Term '%s' Not Found", name))
+}
+
+// Determines whether or not one term is a kind of another by walking the
+// is_a relationships of the vocabulary.
+//
+// Parameters:
+//   accession: The accession of the term to check
+//   parent: The accession of the possible ancestor
+//
+// Return value:
+//   bool: true if the term is the parent or one of its descendants
+func (cv *ControlledVocabulary) IsA(accession string, parent string) bool {
+	parent = cvAccession(parent)
+	visited := make(map[string]bool)
+	queue := []string{cvAccession(accession)}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if id == parent {
+			return true
+		}
+		if visited[id] {
+			continue
+		}
+		visited[id] = true
+		if term, ok := cv.Terms[id]; ok {
+			queue = append(queue, term.IsA...)
+		}
+	}
+	return false
+}
+
+// Finds the units which may be used for a term's value.
+//
+// Parameters:
+//   accession: The accession of the term
+//
+// Return value:
+//   []*CvTerm: The unit terms, or an empty slice if the term has no units
+func (cv *ControlledVocabulary) Units(accession string) []*CvTerm {
+	var units []*CvTerm
+	if term, err := cv.Term(accession); err == nil {
+		for _, v := range term.Units {
+			if unit, err := cv.Term(v); err == nil {
+				units = append(units, unit)
+			} else {
+				units = append(units, &CvTerm{Id: v})
+			}
+		}
+	}
+	return units
+}
+
+// Determines whether or not a parameter refers to a term. The accessions are
+// compared first, falling back to the name and synonyms of the term when
+// the accessions differ. Obsolete terms match the terms they were replaced
+// by.
+//
+// Parameters:
+//   key: The accession of the term to compare against
+//   accession: The accession of the parameter
+//   name: The name of the parameter
+//
+// Return value:
+//   bool: true if the parameter refers to the term
+func (cv *ControlledVocabulary) Matches(key string, accession string,
+	name string) bool {
+	key = cv.current(key)
+	if accession != "" && cv.current(accession) == key {
+		return true
+	}
+	if name == "" {
+		return false
+	}
+	term, err := cv.Find(name)
+	return err == nil && cv.current(term.Id) == key
+}
+
+// Returns the accession of the term which replaced an obsolete term, or the
+// normalized accession if the term has not been replaced.
+func (cv *ControlledVocabulary) current(accession string) string {
+	accession = cvAccession(accession)
+	visited := make(map[string]bool)
+	for !visited[accession] {
+		visited[accession] = true
+		term, ok := cv.Terms[accession]
+		if !ok || len(term.ReplacedBy) == 0 {
+			break
+		}
+		accession = term.ReplacedBy[0]
+	}
+	return accession
+}
+
+// Normalizes an accession, converting the "PSI" prefix used by mzData to the
+// "MS" prefix used by PSI-MS.
+func cvAccession(accession string) string {
+	accession = strings.TrimSpace(accession)
+	if len(accession) > 4 && strings.ToUpper(accession[:4]) == "PSI:" {
+		return "MS:" + accession[4:]
+	}
+	return accession
+}
+
+// Normalizes a term name for comparison, removing case, whitespace and
+// punctuation other than '/'.
+func cvName(name string) string {
+	out := make([]rune, 0, len(name))
+	for _, c := range strings.ToLower(name) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '/' {
+			out = append(out, c)
+		}
+	}
+	return string(out)
+}
+
+// Removes any trailing comment from an OBO tag value
+func oboValue(value string) string {
+	escaped := false
+	quoted := false
+	for i, c := range value {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case c == '!' && !quoted:
+			return strings.TrimSpace(value[:i])
+		}
+	}
+	return strings.TrimSpace(value)
+}
+
+// Extracts the quoted portion of an OBO tag value, such as a def or synonym
+func oboQuoted(value string) string {
+	if len(value) == 0 || value[0] != '"' {
+		return value
+	}
+	out := make([]rune, 0, len(value))
+	escaped := false
+	for _, c := range value[1:] {
+		if escaped {
+			out = append(out, c)
+			escaped = false
+		} else if c == '\\' {
+			escaped = true
+		} else if c == '"' {
+			break
+		} else {
+			out = append(out, c)
+		}
+	}
+	return string(out)
+}
@@ -0,0 +1,107 @@
+//  Copyright 2013 Thomas McGrew
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package mzlib
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// PSI-MS accessions of common additional data arrays.
+	ChargeArray        string = "MS:1000516"
+	SignalToNoiseArray string = "MS:1000517"
+	ResolutionArray    string = "MS:1002529"
+	BaselineArray      string = "MS:1002530"
+	NoiseArray         string = "MS:1002742"
+)
+
+// Represents an additional array of per peak values in a Scan, such as
+// charge or signal to noise. The Values are aligned with the MzArray of the
+// Scan. Arrays which are not in the PSI-MS vocabulary have an empty
+// Accession.
+type DataArray struct {
+	Accession string
+	Name      string
+	Unit      string
+	Values    []float64
+}
+
+// Creates a copy of this DataArray
+func (a *DataArray) Clone() DataArray {
+	cpy := *a
+	if a.Values != nil {
+		cpy.Values = make([]float64, len(a.Values))
+		copy(cpy.Values, a.Values)
+	}
+	return cpy
+}
+
+// Creates a DataArray for the given name or accession, filling in the other
+// from the PsiMs vocabulary when the term is known.
+//
+// Parameters:
+//   key: The name or accession of the array
+//   values: The values of the array
+//
+// Return value:
+//   DataArray: The new array
+func NewDataArray(key string, values []float64) DataArray {
+	a := DataArray{Name: key, Values: values}
+	term, err := PsiMs.Term(key)
+	if err != nil {
+		term, err = PsiMs.Find(key)
+	}
+	if err == nil {
+		a.Accession = term.Id
+		a.Name = term.Name
+	}
+	return a
+}
+
+// Finds an additional data array in the scan.
+//
+// Parameters:
+//   key: The accession or name of the array
+//
+// Return values:
+//   *DataArray: A pointer to the array, or nil if not found
+//   error: An error if the array was not found
+func (s *Scan) ExtraArray(key string) (*DataArray, error) {
+	for i := range s.ExtraArrays {
+		a := &s.ExtraArrays[i]
+		if a.Name == key || PsiMs.Matches(key, a.Accession, a.Name) {
+			return a, nil
+		}
+	}
+	return nil, errors.New(fmt.Sprintf("Array '%s' Not Found", key))
+}
+
+// Adds an additional data array to the scan, replacing any existing array
+// with the same accession or name.
+//
+// Parameters:
+//   a: The array to add
+func (s *Scan) SetExtraArray(a DataArray) {
+	key := a.Accession
+	if key == "" {
+		key = a.Name
+	}
+	if existing, err := s.ExtraArray(key); err == nil {
+		*existing = a
+		return
+	}
+	s.ExtraArrays = append(s.ExtraArrays, a)
+}
@@ -0,0 +1,148 @@
+//  Copyright 2013 Thomas McGrew
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package mzlib
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// The mass of an electron in Daltons
+	ElectronMass float64 = 0.000548579909
+	// The mass of a proton in Daltons
+	ProtonMass float64 = 1.007276466621
+)
+
+// Represents an isotope of an element
+type Isotope struct {
+	MassNumber int
+	Mass       float64
+	Abundance  float64
+}
+
+// Represents a chemical element and its naturally occurring isotopes, in
+// order of mass
+type Element struct {
+	Symbol   string
+	Name     string
+	Isotopes []Isotope
+}
+
+// The elements known to ParseFormula, by symbol. Masses and abundances are
+// from the NIST Atomic Weights and Isotopic Compositions tables.
+var Elements = map[string]*Element{
+	"H": {"H", "Hydrogen", []Isotope{
+		{1, 1.00782503223, 0.999885}, {2, 2.01410177812, 0.000115}}},
+	"He": {"He", "Helium", []Isotope{
+		{3, 3.0160293201, 0.00000134}, {4, 4.00260325413, 0.99999866}}},
+	"Li": {"Li", "Lithium", []Isotope{
+		{6, 6.0151228874, 0.0759}, {7, 7.0160034366, 0.9241}}},
+	"B": {"B", "Boron", []Isotope{
+		{10, 10.01293695, 0.199}, {11, 11.00930536, 0.801}}},
+	"C": {"C", "Carbon", []Isotope{
+		{12, 12.0, 0.9893}, {13, 13.00335483507, 0.0107}}},
+	"N": {"N", "Nitrogen", []Isotope{
+		{14, 14.00307400443, 0.99636}, {15, 15.00010889888, 0.00364}}},
+	"O": {"O", "Oxygen", []Isotope{
+		{16, 15.99491461957, 0.99757}, {17, 16.99913175650, 0.00038},
+		{18, 17.99915961286, 0.00205}}},
+	"F":  {"F", "Fluorine", []Isotope{{19, 18.99840316273, 1}}},
+	"Na": {"Na", "Sodium", []Isotope{{23, 22.9897692820, 1}}},
+	"Mg": {"Mg", "Magnesium", []Isotope{
+		{24, 23.985041697, 0.7899}, {25, 24.985836976, 0.1000},
+		{26, 25.982592968, 0.1101}}},
+	"Al": {"Al", "Aluminium", []Isotope{{27, 26.98153853, 1}}},
+	"Si": {"Si", "Silicon", []Isotope{
+		{28, 27.97692653465, 0.92223}, {29, 28.97649466490, 0.04685},
+		{30, 29.973770136, 0.03092}}},
+	"P": {"P", "Phosphorus", []Isotope{{31, 30.97376199842, 1}}},
+	"S": {"S", "Sulfur", []Isotope{
+		{32, 31.9720711744, 0.9499}, {33, 32.9714589098, 0.0075},
+		{34, 33.967867004, 0.0425}, {36, 35.96708071, 0.0001}}},
+	"Cl": {"Cl", "Chlorine", []Isotope{
+		{35, 34.968852682, 0.7576}, {37, 36.965902602, 0.2424}}},
+	"K": {"K", "Potassium", []Isotope{
+		{39, 38.9637064864, 0.932581}, {40, 39.963998166, 0.000117},
+		{41, 40.9618252579, 0.067302}}},
+	"Ca": {"Ca", "Calcium", []Isotope{
+		{40, 39.962590863, 0.96941}, {42, 41.95861783, 0.00647},
+		{43, 42.95876644, 0.00135}, {44, 43.9554816, 0.02086},
+		{46, 45.953689, 0.00004}, {48, 47.95252276, 0.00187}}},
+	"Mn": {"Mn", "Manganese", []Isotope{{55, 54.93804391, 1}}},
+	"Fe": {"Fe", "Iron", []Isotope{
+		{54, 53.93960899, 0.05845}, {56, 55.93493633, 0.91754},
+		{57, 56.93539284, 0.02119}, {58, 57.93327443, 0.00282}}},
+	"Co": {"Co", "Cobalt", []Isotope{{59, 58.93319429, 1}}},
+	"Ni": {"Ni", "Nickel", []Isotope{
+		{58, 57.93534241, 0.68077}, {60, 59.93078588, 0.26223},
+		{61, 60.93105557, 0.011399}, {62, 61.92834537, 0.036346},
+		{64, 63.92796682, 0.009255}}},
+	"Cu": {"Cu", "Copper", []Isotope{
+		{63, 62.92959772, 0.6915}, {65, 64.92778970, 0.3085}}},
+	"Zn": {"Zn", "Zinc", []Isotope{
+		{64, 63.92914201, 0.4917}, {66, 65.92603381, 0.2773},
+		{67, 66.92712775, 0.0404}, {68, 67.92484455, 0.1845},
+		{70, 69.9253192, 0.0061}}},
+	"Se": {"Se", "Selenium", []Isotope{
+		{74, 73.922475934, 0.0089}, {76, 75.919213704, 0.0937},
+		{77, 76.919914154, 0.0763}, {78, 77.91730928, 0.2377},
+		{80, 79.9165218, 0.4961}, {82, 81.9166995, 0.0873}}},
+	"Br": {"Br", "Bromine", []Isotope{
+		{79, 78.9183376, 0.5069}, {81, 80.9162897, 0.4931}}},
+	"Ag": {"Ag", "Silver", []Isotope{
+		{107, 106.9050916, 0.51839}, {109, 108.9047553, 0.48161}}},
+	"I":  {"I", "Iodine", []Isotope{{127, 126.9044719, 1}}},
+	"Cs": {"Cs", "Caesium", []Isotope{{133, 132.905451961, 1}}},
+}
+
+// Returns the most abundant isotope of the element
+func (e *Element) Monoisotopic() Isotope {
+	best := e.Isotopes[0]
+	for _, v := range e.Isotopes {
+		if v.Abundance > best.Abundance {
+			best = v
+		}
+	}
+	return best
+}
+
+// Returns the average mass of the element
+func (e *Element) AverageMass() float64 {
+	var mass, abundance float64
+	for _, v := range e.Isotopes {
+		mass += v.Mass * v.Abundance
+		abundance += v.Abundance
+	}
+	return mass / abundance
+}
+
+// Finds an isotope of the element
+//
+// Parameters:
+//   massNumber: The mass number of the isotope
+//
+// Return values:
+//   Isotope: The isotope
+//   error: An error if the element has no such isotope
+func (e *Element) Isotope(massNumber int) (Isotope, error) {
+	for _, v := range e.Isotopes {
+		if v.MassNumber == massNumber {
+			return v, nil
+		}
+	}
+	return Isotope{}, errors.New(fmt.Sprintf("Isotope '%d%s' Not Found",
+		massNumber, e.Symbol))
+}
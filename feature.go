@@ -0,0 +1,249 @@
+//  Copyright 2013 Thomas McGrew
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package mzlib
+
+import (
+	"math"
+	"sort"
+)
+
+// The number of consecutive scans a mass trace may be missing from before it
+// is ended
+const featureMaxGap = 2
+
+// Represents an LC-MS feature, a chromatographic peak of a single ion. Mz is
+// the intensity weighted mean m/z of the monoisotopic peak, and IsotopeCount
+// is the number of isotope peaks found, including the monoisotopic peak.
+type Feature struct {
+	Mz            float64
+	RetentionTime float64
+	StartTime     float64
+	EndTime       float64
+	Area          float64
+	Height        float64
+	Fwhm          float64
+	SignalToNoise float64
+	Charge        int8
+	IsotopeCount  int
+}
+
+// A series of peaks with similar m/z values in consecutive scans
+type massTrace struct {
+	mz        float64
+	weight    float64
+	lastScan  int
+	mzs       []float64
+	times     []float64
+	intensity []float64
+}
+
+// Finds the LC-MS features in the MS1 scans of the data. Peaks within the
+// tolerance of each other in consecutive scans are joined into mass traces,
+// chromatographic peaks are found in each trace, and features with the
+// isotope spacing of a charge state at the same retention time are
+// collapsed into the monoisotopic feature. The scans should be centroided.
+//
+// Parameters:
+//   tolerance: The m/z tolerance for joining peaks into mass traces and for
+//     matching isotopes
+//   minWidth: The minimum full width at half maximum of a peak, in minutes
+//   minProminence: The minimum prominence of a peak in its mass trace
+//
+// Return value:
+//   []Feature: The features, sorted by m/z
+func (r *RawData) FindFeatures(tolerance Tolerance, minWidth float64,
+	minProminence float64) []Feature {
+	traces := r.massTraces(tolerance)
+	features := make([]Feature, 0)
+	for _, trace := range traces {
+		c := Chromatogram{TimeArray: trace.times,
+			IntensityArray: trace.intensity}
+		for _, p := range c.FindPeaks(minWidth, minProminence) {
+			f := Feature{RetentionTime: p.RetentionTime,
+				StartTime: p.StartTime, EndTime: p.EndTime, Area: p.Area,
+				Height: p.Height, Fwhm: p.Fwhm, SignalToNoise: p.SignalToNoise,
+				IsotopeCount: 1}
+			var weight float64
+			for i := p.Start; i <= p.End; i++ {
+				f.Mz += trace.mzs[i] * trace.intensity[i]
+				weight += trace.intensity[i]
+			}
+			if weight > 0 {
+				f.Mz /= weight
+			} else {
+				f.Mz = trace.mz
+			}
+			features = append(features, f)
+		}
+	}
+	sort.Slice(features, func(i, j int) bool {
+		return features[i].Mz < features[j].Mz
+	})
+	return groupIsotopes(features, tolerance)
+}
+
+// Joins the peaks of the MS1 scans into mass traces.
+func (r *RawData) massTraces(tolerance Tolerance) []*massTrace {
+	finished := make([]*massTrace, 0)
+	active := make([]*massTrace, 0)
+	scan := 0
+	for i := range r.Scans {
+		s := &r.Scans[i]
+		if !s.matches(1, 0) {
+			continue
+		}
+		mz, intensity := s.sortedPeaks()
+		// extend the traces with the most intense peaks first
+		order := make([]int, len(mz))
+		for j := range order {
+			order[j] = j
+		}
+		sort.SliceStable(order, func(a, b int) bool {
+			return intensity[order[a]] > intensity[order[b]]
+		})
+		created := make([]*massTrace, 0)
+		for _, j := range order {
+			if intensity[j] <= 0 {
+				continue
+			}
+			minMz, maxMz := tolerance.Range(mz[j])
+			k := sort.Search(len(active), func(k int) bool {
+				return active[k].mz >= minMz
+			})
+			var best *massTrace
+			for ; k < len(active) && active[k].mz <= maxMz; k++ {
+				if active[k].lastScan < scan && (best == nil ||
+					math.Abs(active[k].mz-mz[j]) < math.Abs(best.mz-mz[j])) {
+					best = active[k]
+				}
+			}
+			if best == nil {
+				best = &massTrace{lastScan: scan - 1}
+				created = append(created, best)
+			}
+			best.add(mz[j], s.RetentionTime, intensity[j], scan)
+		}
+		// end any traces which have not been extended recently
+		kept := active[:0]
+		for _, t := range active {
+			if scan-t.lastScan > featureMaxGap {
+				finished = append(finished, t)
+			} else {
+				kept = append(kept, t)
+			}
+		}
+		active = append(kept, created...)
+		sort.Slice(active, func(a, b int) bool {
+			return active[a].mz < active[b].mz
+		})
+		scan++
+	}
+	return append(finished, active...)
+}
+
+// Adds a peak to the mass trace, interpolating the intensity of any scans it
+// was missing from.
+func (t *massTrace) add(mz float64, time float64, intensity float64,
+	scan int) {
+	if n := len(t.times); n > 0 {
+		lastTime, lastIntensity := t.times[n-1], t.intensity[n-1]
+		gap := float64(scan - t.lastScan)
+		for missed := 1; missed < scan-t.lastScan; missed++ {
+			f := float64(missed) / gap
+			t.mzs = append(t.mzs, t.mz)
+			t.times = append(t.times, lastTime+(time-lastTime)*f)
+			t.intensity = append(t.intensity,
+				lastIntensity+(intensity-lastIntensity)*f)
+		}
+	}
+	t.mzs = append(t.mzs, mz)
+	t.times = append(t.times, time)
+	t.intensity = append(t.intensity, intensity)
+	t.weight += intensity
+	t.mz += (mz - t.mz) * intensity / t.weight
+	t.lastScan = scan
+}
+
+// Collapses features with the isotope spacing of a charge state at the same
+// retention time into the monoisotopic feature.
+//
+// Parameters:
+//   features: The features, sorted by m/z
+//   tolerance: The m/z tolerance for matching isotopes
+//
+// Return value:
+//   []Feature: The remaining features, with Charge and IsotopeCount set
+func groupIsotopes(features []Feature, tolerance Tolerance) []Feature {
+	used := make([]bool, len(features))
+	for i := range features {
+		if used[i] {
+			continue
+		}
+		var envelope []int
+		charge := 0
+		for z := 1; z <= MaxIsotopeCharge; z++ {
+			series := isotopeFeatures(features, used, i, float64(z), tolerance)
+			if len(series) > len(envelope) {
+				envelope, charge = series, z
+			}
+		}
+		if len(envelope) < 2 {
+			continue
+		}
+		features[i].Charge = int8(charge)
+		features[i].IsotopeCount = len(envelope)
+		for _, j := range envelope[1:] {
+			used[j] = true
+		}
+	}
+	grouped := make([]Feature, 0, len(features))
+	for i, f := range features {
+		if !used[i] {
+			grouped = append(grouped, f)
+		}
+	}
+	return grouped
+}
+
+// Finds the features of an isotope envelope of the given charge starting
+// with a monoisotopic feature. Each isotope must have its apex between the
+// start and end of the monoisotopic feature.
+func isotopeFeatures(features []Feature, used []bool, start int,
+	charge float64, tolerance Tolerance) []int {
+	series := []int{start}
+	mono := &features[start]
+	last := start
+	for {
+		target := features[last].Mz + IsotopeSpacing/charge
+		minMz, maxMz := tolerance.Range(target)
+		next := -1
+		for j := last + 1; j < len(features) && features[j].Mz <= maxMz; j++ {
+			f := &features[j]
+			if used[j] || f.Mz < minMz || f.RetentionTime < mono.StartTime ||
+				f.RetentionTime > mono.EndTime {
+				continue
+			}
+			if next < 0 || math.Abs(f.RetentionTime-mono.RetentionTime) <
+				math.Abs(features[next].RetentionTime-mono.RetentionTime) {
+				next = j
+			}
+		}
+		if next < 0 {
+			return series
+		}
+		series = append(series, next)
+		last = next
+	}
+}
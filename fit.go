@@ -0,0 +1,104 @@
+//  Copyright 2013 Thomas McGrew
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package mzlib
+
+import (
+	"errors"
+	"math"
+)
+
+// Fits a polynomial to a set of points by least squares.
+//
+// Parameters:
+//   x: The x values of the points
+//   y: The y values of the points
+//   origin: The x value the polynomial is centered on
+//   order: The order of the polynomial
+//
+// Return values:
+//   []float64: The coefficients of the polynomial in (x - origin), starting
+//     with the constant term
+//   error: An error if the polynomial could not be fit
+func polynomialFit(x []float64, y []float64, origin float64,
+	order int) ([]float64, error) {
+	if order >= len(x) {
+		order = len(x) - 1
+	}
+	if order < 0 {
+		return nil, errors.New("No points to fit")
+	}
+	size := order + 1
+	// normal equations
+	matrix := make([][]float64, size)
+	for i := range matrix {
+		matrix[i] = make([]float64, size+1)
+	}
+	powers := make([]float64, 2*size)
+	for i := range x {
+		d := x[i] - origin
+		p := 1.0
+		for k := range powers {
+			powers[k] = p
+			p *= d
+		}
+		for r := 0; r < size; r++ {
+			for c := 0; c < size; c++ {
+				matrix[r][c] += powers[r+c]
+			}
+			matrix[r][size] += powers[r] * y[i]
+		}
+	}
+	return solveLinear(matrix)
+}
+
+// Solves a system of linear equations by gaussian elimination with partial
+// pivoting.
+//
+// Parameters:
+//   matrix: The augmented matrix of the system, which is modified
+//
+// Return values:
+//   []float64: The solution of the system
+//   error: An error if the system is singular
+func solveLinear(matrix [][]float64) ([]float64, error) {
+	size := len(matrix)
+	for c := 0; c < size; c++ {
+		pivot := c
+		for r := c + 1; r < size; r++ {
+			if math.Abs(matrix[r][c]) > math.Abs(matrix[pivot][c]) {
+				pivot = r
+			}
+		}
+		if math.Abs(matrix[pivot][c]) < 1e-300 {
+			return nil, errors.New("Singular matrix")
+		}
+		matrix[c], matrix[pivot] = matrix[pivot], matrix[c]
+		for r := c + 1; r < size; r++ {
+			f := matrix[r][c] / matrix[c][c]
+			for k := c; k <= size; k++ {
+				matrix[r][k] -= f * matrix[c][k]
+			}
+		}
+	}
+	solution := make([]float64, size)
+	for r := size - 1; r >= 0; r-- {
+		sum := matrix[r][size]
+		for k := r + 1; k < size; k++ {
+			sum -= matrix[r][k] * solution[k]
+		}
+		solution[r] = sum / matrix[r][r]
+	}
+	return solution, nil
+}
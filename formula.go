@@ -0,0 +1,537 @@
+//  Copyright 2013 Thomas McGrew
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package mzlib
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Represents a chemical formula. Atoms are counted by element symbol, or by
+// a key such as "[13C]" for specific isotopes.
+type Formula struct {
+	Atoms  map[string]int
+	Charge int
+}
+
+// Parses a chemical formula, such as "C6H12O6", "CH3(CH2)4COOH",
+// "C5[13C]H12O6", "D2O" or "C2H5O-". A charge may be given at the end of the
+// formula as signs ("+", "--") or a sign followed by a number ("+2"). After a
+// closing bracket, the number may also come first, as in "[C6H14O6]2+".
+//
+// Parameters:
+//   formula: The formula to parse
+//
+// Return values:
+//   Formula: The parsed formula
+//   error: An error if the formula is not valid
+func ParseFormula(formula string) (Formula, error) {
+	f := Formula{Atoms: make(map[string]int)}
+	body := strings.TrimSpace(formula)
+	// the charge
+	end := len(body)
+	for end > 0 && body[end-1] >= '0' && body[end-1] <= '9' {
+		end--
+	}
+	signs := end
+	for signs > 0 && (body[signs-1] == '+' || body[signs-1] == '-') {
+		signs--
+	}
+	if signs < end {
+		sign := 1
+		if body[signs] == '-' {
+			sign = -1
+		}
+		count := end - signs
+		if end < len(body) {
+			count, _ = strconv.Atoi(body[end:])
+		} else if count == 1 {
+			// a number before the sign after a closing bracket, as in "]2+"
+			digits := signs
+			for digits > 0 && body[digits-1] >= '0' && body[digits-1] <= '9' {
+				digits--
+			}
+			if digits > 0 && digits < signs &&
+				(body[digits-1] == ')' || body[digits-1] == ']') {
+				count, _ = strconv.Atoi(body[digits:signs])
+				signs = digits
+			}
+		}
+		f.Charge = sign * count
+		body = body[:signs]
+	}
+	p := formulaParser{body, 0}
+	atoms, err := p.group(0)
+	if err != nil {
+		return f, errors.New(fmt.Sprintf("Invalid formula '%s': %s", formula,
+			err))
+	}
+	for k, v := range atoms {
+		if v != 0 {
+			f.Atoms[k] = v
+		}
+	}
+	return f, nil
+}
+
+// Parses the groups of a formula
+type formulaParser struct {
+	formula  string
+	position int
+}
+
+// Parses a group of atoms up to the closing bracket matching the given
+// opening bracket, or to the end of the formula if there is none.
+func (p *formulaParser) group(open byte) (map[string]int, error) {
+	atoms := make(map[string]int)
+	for p.position < len(p.formula) {
+		c := p.formula[p.position]
+		var key string
+		var inner map[string]int
+		switch {
+		case c == ')' || (c == ']' && open == '['):
+			if (c == ')') != (open == '(') {
+				return nil, errors.New(fmt.Sprintf("Unexpected '%c'", c))
+			}
+			p.position++
+			return atoms, nil
+		case c == '[' && p.position+1 < len(p.formula) &&
+			p.formula[p.position+1] >= '0' && p.formula[p.position+1] <= '9':
+			close := strings.IndexByte(p.formula[p.position:], ']')
+			if close < 0 {
+				return nil, errors.New("Unclosed isotope")
+			}
+			key = p.formula[p.position : p.position+close+1]
+			if _, _, err := isotopeKey(key); err != nil {
+				return nil, err
+			}
+			p.position += close + 1
+		case c == '(' || c == '[':
+			p.position++
+			var err error
+			if inner, err = p.group(c); err != nil {
+				return nil, err
+			}
+		case c >= 'A' && c <= 'Z':
+			end := p.position + 1
+			for end < len(p.formula) && p.formula[end] >= 'a' &&
+				p.formula[end] <= 'z' {
+				end++
+			}
+			key = p.formula[p.position:end]
+			p.position = end
+			if key == "D" {
+				key = "[2H]"
+			} else if _, ok := Elements[key]; !ok {
+				return nil, errors.New(fmt.Sprintf("Unknown element '%s'", key))
+			}
+		case c == '.' || c == '*' || c == ' ':
+			// a separator such as in CuSO4.5H2O, multiplying what follows
+			p.position++
+			count := p.count()
+			rest, err := p.group(open)
+			if err != nil {
+				return nil, err
+			}
+			for k, v := range rest {
+				atoms[k] += v * count
+			}
+			return atoms, nil
+		default:
+			return nil, errors.New(fmt.Sprintf("Unexpected '%c'", c))
+		}
+		count := p.count()
+		if inner != nil {
+			for k, v := range inner {
+				atoms[k] += v * count
+			}
+		} else {
+			atoms[key] += count
+		}
+	}
+	if open != 0 {
+		return nil, errors.New(fmt.Sprintf("Unclosed '%c'", open))
+	}
+	return atoms, nil
+}
+
+// Parses the number at the current position, which is 1 if there is none
+func (p *formulaParser) count() int {
+	end := p.position
+	for end < len(p.formula) && p.formula[end] >= '0' &&
+		p.formula[end] <= '9' {
+		end++
+	}
+	if end == p.position {
+		return 1
+	}
+	count, _ := strconv.Atoi(p.formula[p.position:end])
+	p.position = end
+	return count
+}
+
+// Returns the element and isotope for a key such as "[13C]".
+func isotopeKey(key string) (*Element, Isotope, error) {
+	inner := strings.Trim(key, "[]")
+	digits := 0
+	for digits < len(inner) && inner[digits] >= '0' && inner[digits] <= '9' {
+		digits++
+	}
+	e, ok := Elements[inner[digits:]]
+	if !ok {
+		return nil, Isotope{}, errors.New(fmt.Sprintf("Unknown element '%s'",
+			inner[digits:]))
+	}
+	massNumber, _ := strconv.Atoi(inner[:digits])
+	isotope, err := e.Isotope(massNumber)
+	return e, isotope, err
+}
+
+// Returns the isotopes of an atom in the formula, which is the single
+// isotope for keys such as "[13C]".
+func atomIsotopes(key string) []Isotope {
+	if strings.HasPrefix(key, "[") {
+		_, isotope, err := isotopeKey(key)
+		if err != nil {
+			return nil
+		}
+		isotope.Abundance = 1
+		return []Isotope{isotope}
+	}
+	if e, ok := Elements[key]; ok {
+		return e.Isotopes
+	}
+	return nil
+}
+
+// Returns the formula in Hill order, with carbon and hydrogen first and the
+// remaining elements in alphabetical order. Specific isotopes follow their
+// element.
+func (f Formula) String() string {
+	keys := make([]string, 0, len(f.Atoms))
+	for k, v := range f.Atoms {
+		if v != 0 {
+			keys = append(keys, k)
+		}
+	}
+	symbol := func(key string) string {
+		if strings.HasPrefix(key, "[") {
+			inner := strings.Trim(key, "[]")
+			return strings.TrimLeft(inner, "0123456789")
+		}
+		return key
+	}
+	_, hasCarbon := f.Atoms["C"]
+	rank := func(key string) string {
+		s := symbol(key)
+		if hasCarbon && s == "C" {
+			return "0"
+		}
+		if hasCarbon && s == "H" {
+			return "1"
+		}
+		return "2" + s
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if rank(keys[i]) != rank(keys[j]) {
+			return rank(keys[i]) < rank(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+	out := new(strings.Builder)
+	for _, k := range keys {
+		out.WriteString(k)
+		if f.Atoms[k] != 1 {
+			out.WriteString(strconv.Itoa(f.Atoms[k]))
+		}
+	}
+	switch {
+	case f.Charge == 1:
+		out.WriteString("+")
+	case f.Charge == -1:
+		out.WriteString("-")
+	case f.Charge > 1:
+		out.WriteString(fmt.Sprintf("+%d", f.Charge))
+	case f.Charge < -1:
+		out.WriteString(fmt.Sprintf("-%d", -f.Charge))
+	}
+	return out.String()
+}
+
+// Creates a copy of this Formula
+func (f Formula) Clone() Formula {
+	cpy := Formula{Atoms: make(map[string]int), Charge: f.Charge}
+	for k, v := range f.Atoms {
+		cpy.Atoms[k] = v
+	}
+	return cpy
+}
+
+// Adds the atoms and charge of another formula to a copy of this formula
+//
+// Parameters:
+//   other: The formula to add
+//
+// Return value:
+//   Formula: The combined formula
+func (f Formula) Add(other Formula) Formula {
+	sum := f.Clone()
+	for k, v := range other.Atoms {
+		sum.Atoms[k] += v
+		if sum.Atoms[k] == 0 {
+			delete(sum.Atoms, k)
+		}
+	}
+	sum.Charge += other.Charge
+	return sum
+}
+
+// Subtracts the atoms and charge of another formula from a copy of this
+// formula
+//
+// Parameters:
+//   other: The formula to subtract
+//
+// Return value:
+//   Formula: The resulting formula, which may have negative counts
+func (f Formula) Subtract(other Formula) Formula {
+	return f.Add(other.Multiply(-1))
+}
+
+// Multiplies the atoms and charge of a copy of this formula
+//
+// Parameters:
+//   n: The multiplier
+//
+// Return value:
+//   Formula: The resulting formula
+func (f Formula) Multiply(n int) Formula {
+	product := Formula{Atoms: make(map[string]int), Charge: f.Charge * n}
+	for k, v := range f.Atoms {
+		if v*n != 0 {
+			product.Atoms[k] = v * n
+		}
+	}
+	return product
+}
+
+// Returns the monoisotopic mass of the formula, using the most abundant
+// isotope of each element and accounting for the electrons of the charge.
+func (f Formula) MonoisotopicMass() float64 {
+	mass := -float64(f.Charge) * ElectronMass
+	for k, v := range f.Atoms {
+		if strings.HasPrefix(k, "[") {
+			if _, isotope, err := isotopeKey(k); err == nil {
+				mass += isotope.Mass * float64(v)
+			}
+		} else if e, ok := Elements[k]; ok {
+			mass += e.Monoisotopic().Mass * float64(v)
+		}
+	}
+	return mass
+}
+
+// Returns the average mass of the formula, accounting for the electrons of
+// the charge.
+func (f Formula) AverageMass() float64 {
+	mass := -float64(f.Charge) * ElectronMass
+	for k, v := range f.Atoms {
+		if strings.HasPrefix(k, "[") {
+			if _, isotope, err := isotopeKey(k); err == nil {
+				mass += isotope.Mass * float64(v)
+			}
+		} else if e, ok := Elements[k]; ok {
+			mass += e.AverageMass() * float64(v)
+		}
+	}
+	return mass
+}
+
+// Returns the monoisotopic m/z value of the formula, which is its mass for
+// a neutral formula.
+func (f Formula) Mz() float64 {
+	return formulaMz(f.MonoisotopicMass(), f.Charge)
+}
+
+// Calculates the fine structure isotope pattern of the formula, with each
+// combination of isotopes as a separate peak. The pattern is returned as a
+// centroided Scan with m/z values for the charge of the formula and
+// intensities relative to the most abundant peak, which is 1.
+//
+// Parameters:
+//   minAbundance: The minimum relative intensity of a peak to be included
+//
+// Return value:
+//   *Scan: The isotope pattern
+func (f Formula) FineIsotopePattern(minAbundance float64) *Scan {
+	peaks := f.isotopePeaks(minAbundance)
+	return f.patternScan(peaks, minAbundance)
+}
+
+// Calculates the isotope pattern of the formula as it would be measured at
+// the given resolution. Peaks of the fine structure closer than the peak
+// width at their m/z are combined at their abundance weighted mean m/z. A
+// resolution of 0 combines all peaks with the same nominal mass.
+//
+// Parameters:
+//   resolution: The resolution, as m/z divided by the peak width
+//   minAbundance: The minimum relative intensity of a peak to be included
+//
+// Return value:
+//   *Scan: The isotope pattern, as for FineIsotopePattern
+func (f Formula) IsotopePattern(resolution float64,
+	minAbundance float64) *Scan {
+	peaks := f.isotopePeaks(minAbundance * 1e-3)
+	mono := f.MonoisotopicMass()
+	combined := make([]isotopePeak, 0)
+	for i := 0; i < len(peaks); {
+		sum, weighted := 0.0, 0.0
+		j := i
+		for ; j < len(peaks); j++ {
+			if resolution > 0 {
+				width := formulaMz(peaks[i].mass, f.Charge) / resolution
+				if formulaMz(peaks[j].mass, f.Charge)-
+					formulaMz(peaks[i].mass, f.Charge) > width {
+					break
+				}
+			} else if math.Round(peaks[j].mass-mono) !=
+				math.Round(peaks[i].mass-mono) {
+				break
+			}
+			sum += peaks[j].abundance
+			weighted += peaks[j].mass * peaks[j].abundance
+		}
+		combined = append(combined, isotopePeak{weighted / sum, sum})
+		i = j
+	}
+	return f.patternScan(combined, minAbundance)
+}
+
+// A peak of an isotope pattern
+type isotopePeak struct {
+	mass      float64
+	abundance float64
+}
+
+// Calculates the fine structure of the isotope pattern as masses and
+// abundances, sorted by mass, pruning peaks far below the minimum abundance
+// as each element is added.
+func (f Formula) isotopePeaks(minAbundance float64) []isotopePeak {
+	prune := minAbundance * 1e-3
+	pattern := []isotopePeak{{0, 1}}
+	keys := make([]string, 0, len(f.Atoms))
+	for k := range f.Atoms {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		count := f.Atoms[k]
+		isotopes := atomIsotopes(k)
+		if count <= 0 || isotopes == nil {
+			continue
+		}
+		element := make([]isotopePeak, len(isotopes))
+		for i, v := range isotopes {
+			element[i] = isotopePeak{v.Mass, v.Abundance}
+		}
+		// raise the element pattern to the power of the count by squaring
+		power := []isotopePeak{{0, 1}}
+		for ; count > 0; count >>= 1 {
+			if count&1 == 1 {
+				power = convolveIsotopes(power, element, prune)
+			}
+			if count > 1 {
+				element = convolveIsotopes(element, element, prune)
+			}
+		}
+		pattern = convolveIsotopes(pattern, power, prune)
+	}
+	electrons := float64(f.Charge) * ElectronMass
+	for i := range pattern {
+		pattern[i].mass -= electrons
+	}
+	return pattern
+}
+
+// Combines two isotope patterns, merging peaks with the same mass and
+// removing peaks below the given fraction of the most abundant peak.
+func convolveIsotopes(a []isotopePeak, b []isotopePeak,
+	prune float64) []isotopePeak {
+	peaks := make([]isotopePeak, 0, len(a)*len(b))
+	for _, x := range a {
+		for _, y := range b {
+			peaks = append(peaks,
+				isotopePeak{x.mass + y.mass, x.abundance * y.abundance})
+		}
+	}
+	sort.Slice(peaks, func(i, j int) bool {
+		return peaks[i].mass < peaks[j].mass
+	})
+	merged := make([]isotopePeak, 0, len(peaks))
+	highest := 0.0
+	for _, p := range peaks {
+		n := len(merged)
+		if n > 0 && p.mass-merged[n-1].mass < 1e-7 {
+			merged[n-1].abundance += p.abundance
+		} else {
+			merged = append(merged, p)
+		}
+	}
+	for _, p := range merged {
+		highest = math.Max(highest, p.abundance)
+	}
+	pruned := merged[:0]
+	for _, p := range merged {
+		if p.abundance >= highest*prune {
+			pruned = append(pruned, p)
+		}
+	}
+	return pruned
+}
+
+// Creates a Scan from isotope peaks, scaling the intensities to a maximum of
+// 1 and removing peaks below the minimum abundance.
+func (f Formula) patternScan(peaks []isotopePeak,
+	minAbundance float64) *Scan {
+	s := &Scan{MsLevel: 1}
+	if f.Charge > 0 {
+		s.Polarity = 1
+	} else if f.Charge < 0 {
+		s.Polarity = -1
+	}
+	highest := 0.0
+	for _, p := range peaks {
+		highest = math.Max(highest, p.abundance)
+	}
+	for _, p := range peaks {
+		if highest > 0 && p.abundance/highest >= minAbundance {
+			s.MzArray = append(s.MzArray, formulaMz(p.mass, f.Charge))
+			s.IntensityArray = append(s.IntensityArray, p.abundance/highest)
+		}
+	}
+	return s
+}
+
+// Converts a mass to an m/z value for a charge
+func formulaMz(mass float64, charge int) float64 {
+	if charge == 0 {
+		return mass
+	}
+	return mass / math.Abs(float64(charge))
+}
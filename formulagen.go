@@ -0,0 +1,294 @@
+//  Copyright 2013 Thomas McGrew
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package mzlib
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// The valences of the elements used to calculate the ring and double bond
+// equivalents of a formula
+var elementValences = map[string]int{
+	"H": 1, "Li": 1, "B": 3, "C": 4, "N": 3, "O": 2, "F": 1, "Na": 1,
+	"Mg": 2, "Si": 4, "P": 3, "S": 2, "Cl": 1, "K": 1, "Ca": 2, "Se": 2,
+	"Br": 1, "I": 1,
+}
+
+// The maximum ratio of each element to carbon in the ElementRatios filter,
+// from the seven golden rules of Kind and Fiehn (2007).
+var elementRatios = map[string]float64{
+	"H": 3.1, "N": 1.3, "O": 1.2, "P": 0.3, "S": 0.8, "F": 6, "Cl": 0.8,
+	"Br": 0.8, "Si": 0.5,
+}
+
+// The minimum ratio of hydrogen to carbon in the ElementRatios filter
+const minHydrogenRatio = 0.2
+
+// The range of counts of an element in generated formulas
+type ElementRange struct {
+	Symbol string
+	Min    int
+	Max    int
+}
+
+// The limits applied when generating formulas. Formulas with ring and
+// double bond equivalents outside MinRdbe and MaxRdbe are rejected.
+// NitrogenRule rejects formulas whose nominal mass and nitrogen count
+// differ in parity, and ElementRatios rejects formulas with unlikely ratios
+// of elements to carbon.
+type FormulaConstraints struct {
+	Elements      []ElementRange
+	MinRdbe       float64
+	MaxRdbe       float64
+	NitrogenRule  bool
+	ElementRatios bool
+}
+
+// A formula generated for a measured m/z value. Error is the difference
+// between the calculated and measured m/z in ppm. IsotopeScore is the
+// agreement of the isotope pattern with a scan between 0 and 1, or 0 if the
+// candidate has not been ranked.
+type FormulaCandidate struct {
+	Formula      Formula
+	Adduct       Adduct
+	Mz           float64
+	Error        float64
+	Rdbe         float64
+	IsotopeScore float64
+}
+
+// Returns the constraints for small organic molecules, with up to 100
+// carbons and the elements H, N, O, P and S, using all of the filters.
+func DefaultFormulaConstraints() FormulaConstraints {
+	return FormulaConstraints{
+		Elements: []ElementRange{
+			{"C", 0, 100}, {"H", 0, 200}, {"N", 0, 20}, {"O", 0, 40},
+			{"P", 0, 5}, {"S", 0, 5}},
+		MinRdbe:       -0.5,
+		MaxRdbe:       50,
+		NitrogenRule:  true,
+		ElementRatios: true,
+	}
+}
+
+// Calculates the ring and double bond equivalents of the formula from the
+// lowest valence of each element. Atoms of unknown valence are ignored.
+func (f Formula) Rdbe() float64 {
+	rdbe := 1.0
+	for k, v := range f.Atoms {
+		symbol := k
+		if e, _, err := isotopeKey(k); err == nil && e != nil {
+			symbol = e.Symbol
+		}
+		if valence, ok := elementValences[symbol]; ok {
+			rdbe += float64(v*(valence-2)) / 2
+		}
+	}
+	return rdbe
+}
+
+// Calculates the nominal mass of the formula from the mass number of the
+// most abundant isotope of each element.
+func (f Formula) nominalMass() int {
+	mass := 0
+	for k, v := range f.Atoms {
+		if strings.HasPrefix(k, "[") {
+			if _, isotope, err := isotopeKey(k); err == nil {
+				mass += isotope.MassNumber * v
+			}
+		} else if e, ok := Elements[k]; ok {
+			mass += e.Monoisotopic().MassNumber * v
+		}
+	}
+	return mass
+}
+
+// Determines whether a neutral formula passes the filters of the
+// constraints.
+func (c FormulaConstraints) accepts(f Formula) bool {
+	rdbe := f.Rdbe()
+	if rdbe < c.MinRdbe || rdbe > c.MaxRdbe {
+		return false
+	}
+	if c.NitrogenRule && f.nominalMass()%2 != f.Atoms["N"]%2 {
+		return false
+	}
+	if c.ElementRatios && f.Atoms["C"] > 0 {
+		carbon := float64(f.Atoms["C"])
+		if float64(f.Atoms["H"])/carbon < minHydrogenRatio {
+			return false
+		}
+		for k, v := range f.Atoms {
+			if ratio, ok := elementRatios[k]; ok && float64(v)/carbon > ratio {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Generates the formulas of molecules whose adduct has an m/z value within
+// the tolerance of the measured value and which pass the filters of the
+// constraints.
+//
+// Parameters:
+//   mz: The measured m/z value
+//   adduct: The adduct the molecule was measured as, such as [M+H]+
+//   tolerance: The tolerance of the m/z value
+//   constraints: The elements and filters to use
+//
+// Return values:
+//   []FormulaCandidate: The candidates, in order of increasing absolute error
+//   error: An error if the constraints contain an unknown element
+func GenerateFormulas(mz float64, adduct Adduct, tolerance Tolerance,
+	constraints FormulaConstraints) ([]FormulaCandidate, error) {
+	ranges := make([]ElementRange, len(constraints.Elements))
+	copy(ranges, constraints.Elements)
+	masses := make([]float64, len(ranges))
+	for i, r := range ranges {
+		e, ok := Elements[r.Symbol]
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("Element '%s' Not Found",
+				r.Symbol))
+		}
+		masses[i] = e.Monoisotopic().Mass
+	}
+	// heaviest elements first, so the lighter ones can fill the remainder
+	sort.Sort(elementRangeSorter{ranges, masses})
+	minMz, maxMz := tolerance.Range(mz)
+	minMass, maxMass := adduct.NeutralMass(minMz), adduct.NeutralMass(maxMz)
+	// the smallest and largest mass of the elements after each position
+	minRest := make([]float64, len(ranges)+1)
+	maxRest := make([]float64, len(ranges)+1)
+	for i := len(ranges) - 1; i >= 0; i-- {
+		minRest[i] = minRest[i+1] + float64(ranges[i].Min)*masses[i]
+		maxRest[i] = maxRest[i+1] + float64(ranges[i].Max)*masses[i]
+	}
+	candidates := make([]FormulaCandidate, 0)
+	counts := make([]int, len(ranges))
+	var search func(i int, mass float64)
+	search = func(i int, mass float64) {
+		if i == len(ranges) {
+			if mass < minMass {
+				return
+			}
+			f := Formula{Atoms: make(map[string]int)}
+			for j, n := range counts {
+				if n != 0 {
+					f.Atoms[ranges[j].Symbol] = n
+				}
+			}
+			if len(f.Atoms) == 0 || !constraints.accepts(f) {
+				return
+			}
+			m := adduct.Mz(f.MonoisotopicMass())
+			candidates = append(candidates, FormulaCandidate{Formula: f,
+				Adduct: adduct, Mz: m, Error: (m - mz) / mz * 1e6,
+				Rdbe: f.Rdbe()})
+			return
+		}
+		for n := ranges[i].Min; n <= ranges[i].Max; n++ {
+			m := mass + float64(n)*masses[i]
+			if m+minRest[i+1] > maxMass {
+				break
+			}
+			if m+maxRest[i+1] < minMass {
+				continue
+			}
+			counts[i] = n
+			search(i+1, m)
+		}
+		counts[i] = 0
+	}
+	search(0, 0)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return math.Abs(candidates[i].Error) < math.Abs(candidates[j].Error)
+	})
+	return candidates, nil
+}
+
+// Sorts element ranges and their masses by decreasing mass
+type elementRangeSorter struct {
+	ranges []ElementRange
+	masses []float64
+}
+
+func (s elementRangeSorter) Len() int {
+	return len(s.ranges)
+}
+
+func (s elementRangeSorter) Less(i, j int) bool {
+	return s.masses[i] > s.masses[j]
+}
+
+func (s elementRangeSorter) Swap(i, j int) {
+	s.ranges[i], s.ranges[j] = s.ranges[j], s.ranges[i]
+	s.masses[i], s.masses[j] = s.masses[j], s.masses[i]
+}
+
+// Scores formula candidates by the agreement of their isotope patterns with
+// the peaks of the scan, and sorts them by decreasing score. Both patterns
+// are scaled to a total of 1 and the score is 1 minus half of the summed
+// absolute differences, so a perfect match scores 1 and a candidate with no
+// matching peaks scores 0.
+//
+// Parameters:
+//   candidates: The candidates to score, such as from GenerateFormulas
+//   tolerance: The tolerance for matching isotope peaks in the scan
+//   resolution: The resolution used to calculate the isotope patterns, as for
+//     Formula.IsotopePattern
+//
+// Return value:
+//   []FormulaCandidate: The scored candidates, in order of decreasing score
+func (s *Scan) RankFormulas(candidates []FormulaCandidate,
+	tolerance Tolerance, resolution float64) []FormulaCandidate {
+	mzArray, intensityArray := s.sortedPeaks()
+	ranked := make([]FormulaCandidate, len(candidates))
+	copy(ranked, candidates)
+	for i := range ranked {
+		pattern := ranked[i].Adduct.Ion(ranked[i].Formula).IsotopePattern(
+			resolution, 1e-3)
+		observed := make([]float64, len(pattern.MzArray))
+		total := 0.0
+		for j, mz := range pattern.MzArray {
+			minMz, maxMz := tolerance.Range(mz)
+			k := sort.SearchFloat64s(mzArray, minMz)
+			for ; k < len(mzArray) && mzArray[k] <= maxMz; k++ {
+				observed[j] += intensityArray[k]
+			}
+			total += math.Max(observed[j], 0)
+		}
+		if total == 0 {
+			ranked[i].IsotopeScore = 0
+			continue
+		}
+		theoretical := pattern.IntensityArray
+		scaleToTotal(theoretical)
+		scaleToTotal(observed)
+		difference := 0.0
+		for j := range theoretical {
+			difference += math.Abs(theoretical[j] - observed[j])
+		}
+		ranked[i].IsotopeScore = 1 - difference/2
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].IsotopeScore > ranked[j].IsotopeScore
+	})
+	return ranked
+}
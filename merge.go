@@ -0,0 +1,240 @@
+//  Copyright 2013 Thomas McGrew
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package mzlib
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+// Merges scans into a single scan. For centroided scans, peaks within the
+// tolerance of each other are combined into a peak at their intensity
+// weighted mean m/z. If all of the scans are continuous, each scan is
+// resampled onto the combined m/z values of all the scans, with m/z values
+// within the tolerance of each other treated as the same value. The merged
+// scan takes its metadata from the first scan, with the mean retention time
+// of the scans. ExtraArrays and ion mobility values are not merged.
+//
+// Parameters:
+//   scans: The scans to merge
+//   tolerance: The tolerance for combining m/z values
+//   average: Whether to average the intensities instead of summing them
+//
+// Return value:
+//   *Scan: The merged scan, or nil if there are no scans
+func MergeScans(scans []*Scan, tolerance Tolerance, average bool) *Scan {
+	if len(scans) == 0 {
+		return nil
+	}
+	merged := scans[0].Clone()
+	merged.ExtraArrays = nil
+	merged.MobilityArray = nil
+	merged.Mobility = 0
+	merged.MobilityUnit = ""
+	merged.RetentionTime = 0
+	continuous := true
+	for _, s := range scans {
+		merged.RetentionTime += s.RetentionTime / float64(len(scans))
+		continuous = continuous && s.Continuous
+		if s.MzRange[1] == 0 {
+			continue
+		}
+		if merged.MzRange[1] == 0 || s.MzRange[0] < merged.MzRange[0] {
+			merged.MzRange[0] = s.MzRange[0]
+		}
+		if s.MzRange[1] > merged.MzRange[1] {
+			merged.MzRange[1] = s.MzRange[1]
+		}
+	}
+	if continuous {
+		merged.MzArray, merged.IntensityArray = mergeProfiles(scans, tolerance)
+	} else {
+		merged.MzArray, merged.IntensityArray = mergeCentroids(scans, tolerance)
+		merged.Continuous = false
+	}
+	if average {
+		for i := range merged.IntensityArray {
+			merged.IntensityArray[i] /= float64(len(scans))
+		}
+	}
+	return merged
+}
+
+// Merges all of the scans with the given ms level and polarity in a range of
+// retention times into a single scan.
+//
+// Parameters:
+//   minTime: The minimum retention time of the scans to merge
+//   maxTime: The maximum retention time of the scans to merge
+//   msLevel: The ms level of the scans to merge
+//   polarity: The polarity of the scans to merge, or 0 for any polarity
+//   tolerance: The tolerance for combining m/z values
+//   average: Whether to average the intensities instead of summing them
+//
+// Return values:
+//   *Scan: The merged scan
+//   error: An error if no scans were found
+func (r *RawData) MergeScans(minTime float64, maxTime float64, msLevel uint8,
+	polarity int8, tolerance Tolerance, average bool) (*Scan, error) {
+	scans := make([]*Scan, 0)
+	for i := range r.Scans {
+		s := &r.Scans[i]
+		if s.matches(msLevel, polarity) && s.RetentionTime >= minTime &&
+			s.RetentionTime <= maxTime {
+			scans = append(scans, s)
+		}
+	}
+	if len(scans) == 0 {
+		return nil, errors.New("No scans found in the retention time range")
+	}
+	return MergeScans(scans, tolerance, average), nil
+}
+
+// Merges the scans with the given ms level and polarity closest to a
+// retention time into a single scan.
+//
+// Parameters:
+//   retentionTime: The retention time to merge scans around
+//   n: The number of scans to merge
+//   msLevel: The ms level of the scans to merge
+//   polarity: The polarity of the scans to merge, or 0 for any polarity
+//   tolerance: The tolerance for combining m/z values
+//   average: Whether to average the intensities instead of summing them
+//
+// Return values:
+//   *Scan: The merged scan
+//   error: An error if no scans were found
+func (r *RawData) MergeScansAround(retentionTime float64, n int,
+	msLevel uint8, polarity int8, tolerance Tolerance,
+	average bool) (*Scan, error) {
+	scans := make([]*Scan, 0)
+	for i := range r.Scans {
+		if r.Scans[i].matches(msLevel, polarity) {
+			scans = append(scans, &r.Scans[i])
+		}
+	}
+	if len(scans) == 0 || n < 1 {
+		return nil, errors.New("No scans found")
+	}
+	sort.SliceStable(scans, func(i, j int) bool {
+		return math.Abs(scans[i].RetentionTime-retentionTime) <
+			math.Abs(scans[j].RetentionTime-retentionTime)
+	})
+	if n < len(scans) {
+		scans = scans[:n]
+	}
+	sort.SliceStable(scans, func(i, j int) bool {
+		return scans[i].RetentionTime < scans[j].RetentionTime
+	})
+	return MergeScans(scans, tolerance, average), nil
+}
+
+// Combines the peaks of centroided scans, summing the intensities.
+func mergeCentroids(scans []*Scan, tolerance Tolerance) ([]float64,
+	[]float64) {
+	type peak struct{ mz, intensity float64 }
+	peaks := make([]peak, 0)
+	for _, s := range scans {
+		for i, v := range s.MzArray {
+			peaks = append(peaks, peak{v, s.IntensityArray[i]})
+		}
+	}
+	sort.Slice(peaks, func(i, j int) bool {
+		return peaks[i].mz < peaks[j].mz
+	})
+	mz := make([]float64, 0)
+	intensity := make([]float64, 0)
+	for i := 0; i < len(peaks); {
+		sum, weighted := 0.0, 0.0
+		center := peaks[i].mz
+		j := i
+		for ; j < len(peaks) && tolerance.Matches(center, peaks[j].mz); j++ {
+			sum += peaks[j].intensity
+			weighted += peaks[j].mz * peaks[j].intensity
+			if sum > 0 {
+				center = weighted / sum
+			}
+		}
+		if sum > 0 {
+			mz = append(mz, weighted/sum)
+		} else {
+			mz = append(mz, center)
+		}
+		intensity = append(intensity, sum)
+		i = j
+	}
+	return mz, intensity
+}
+
+// Resamples continuous scans onto their combined m/z values by linear
+// interpolation, summing the intensities.
+func mergeProfiles(scans []*Scan, tolerance Tolerance) ([]float64,
+	[]float64) {
+	all := make([]float64, 0)
+	for _, s := range scans {
+		all = append(all, s.MzArray...)
+	}
+	sort.Float64s(all)
+	grid := make([]float64, 0, len(all))
+	for i := 0; i < len(all); {
+		j := i + 1
+		for j < len(all) && tolerance.Matches(all[i], all[j]) {
+			j++
+		}
+		grid = append(grid, (all[i]+all[j-1])/2)
+		i = j
+	}
+	intensity := make([]float64, len(grid))
+	for _, s := range scans {
+		mz, y := s.sortedPeaks()
+		for i, v := range resample(mz, y, grid) {
+			intensity[i] += v
+		}
+	}
+	return grid, intensity
+}
+
+// Resamples a signal onto new x values by linear interpolation. Values
+// outside the range of the signal are 0.
+//
+// Parameters:
+//   x: The x values of the signal, sorted
+//   y: The y values of the signal
+//   grid: The new x values, sorted
+//
+// Return value:
+//   []float64: The y values at each of the new x values
+func resample(x []float64, y []float64, grid []float64) []float64 {
+	resampled := make([]float64, len(grid))
+	if len(x) == 0 {
+		return resampled
+	}
+	j := 0
+	for i, v := range grid {
+		if v < x[0] || v > x[len(x)-1] {
+			continue
+		}
+		for j+1 < len(x) && x[j+1] < v {
+			j++
+		}
+		if j+1 >= len(x) || x[j] >= v {
+			resampled[i] = y[j]
+		} else {
+			resampled[i] = y[j] + (y[j+1]-y[j])*(v-x[j])/(x[j+1]-x[j])
+		}
+	}
+	return resampled
+}
@@ -0,0 +1,173 @@
+//  Copyright 2013 Thomas McGrew
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package mzlib
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+const (
+	// Units for Scan.MobilityUnit.
+	MobilityMillisecond string = "ms"
+	MobilityVsPerCm2    string = "Vs/cm^2"
+	MobilityVolt        string = "V"
+)
+
+// The PSI-MS accessions of the scan level ion mobility terms, in order of
+// preference.
+var mobilityTerms = []string{
+	"MS:1002815", // inverse reduced ion mobility
+	"MS:1002476", // ion mobility drift time
+	"MS:1001581", // FAIMS compensation voltage
+}
+
+// The Scan.MobilityUnit values for the unit accessions of the mobility terms.
+var mobilityUnits = map[string]string{
+	"UO:0000028": MobilityMillisecond,
+	"MS:1002814": MobilityVsPerCm2,
+	"UO:0000218": MobilityVolt,
+}
+
+// Determines the Scan.MobilityUnit value for a mobility parameter, falling
+// back to the default unit of the term when the parameter has none.
+//
+// Parameters:
+//   accession: The accession of the mobility term
+//   unitAccession: The accession of the unit given with the parameter
+//   unitName: The name of the unit given with the parameter
+//
+// Return value:
+//   string: The unit
+func mobilityUnit(accession string, unitAccession string,
+	unitName string) string {
+	if unitAccession == "" {
+		if units := PsiMs.Units(accession); len(units) > 0 {
+			unitAccession = units[0].Id
+			unitName = units[0].Name
+		}
+	}
+	if unit, ok := mobilityUnits[unitAccession]; ok {
+		return unit
+	}
+	return unitName
+}
+
+// Determines whether or not the scan has ion mobility information.
+func (s *Scan) HasMobility() bool {
+	return s.MobilityUnit != "" || len(s.MobilityArray) > 0
+}
+
+// Returns the ion mobility of a peak in the scan
+//
+// Parameters:
+//   i: The index of the peak
+//
+// Return value:
+//   float64: The mobility from MobilityArray, or the scan level Mobility
+//     if the scan has no MobilityArray
+func (s *Scan) PeakMobility(i int) float64 {
+	if i < len(s.MobilityArray) {
+		return s.MobilityArray[i]
+	}
+	return s.Mobility
+}
+
+// Returns a mobilogram for the data, summing the intensity of all peaks in
+// level 1 scans which fall within the given m/z and retention time range.
+//
+// Parameters:
+//   minMz: The minimum m/z value to select peaks from.
+//   maxMz: The maximum m/z value to select peaks from.
+//   minTime: The minimum retention time value in minutes to select scans from.
+//   maxTime: The maximum retention time value in minutes to select scans from.
+//   binWidth: The width of each mobility bin, in the units of the data.
+//
+// Return values:
+//   []float64: The center of each mobility bin, in ascending order.
+//   []float64: The total intensity of the peaks in each mobility bin.
+//   error: An error if the bin width is not positive
+func (r *RawData) Mobilogram(minMz float64, maxMz float64, minTime float64,
+	maxTime float64, binWidth float64) ([]float64, []float64, error) {
+	if !(binWidth > 0) {
+		return nil, nil, errors.New(fmt.Sprintf("Invalid bin width %v",
+			binWidth))
+	}
+	bins := make(map[int64]float64)
+	for _, s := range r.Scans {
+		if s.MsLevel != 1 || !s.HasMobility() ||
+			s.RetentionTime < minTime || s.RetentionTime > maxTime {
+			continue
+		}
+		for i, v := range s.MzArray {
+			if v > minMz && v < maxMz {
+				bin := int64(math.Floor(s.PeakMobility(i) / binWidth))
+				bins[bin] += s.IntensityArray[i]
+			}
+		}
+	}
+	keys := make([]int64, 0, len(bins))
+	for k := range bins {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	mobility := make([]float64, 0, len(keys))
+	intensity := make([]float64, 0, len(keys))
+	for _, k := range keys {
+		mobility = append(mobility, (float64(k)+0.5)*binWidth)
+		intensity = append(intensity, bins[k])
+	}
+	return mobility, intensity, nil
+}
+
+// Returns a selected ion chromatogram for the data, including only peaks
+// which fall within the given ion mobility range.
+//
+// Parameters:
+//   minMz: The minimum m/z value to select peaks from.
+//   maxMz: The maximum m/z value to select peaks from.
+//   minMobility: The minimum ion mobility value to select peaks from.
+//   maxMobility: The maximum ion mobility value to select peaks from.
+//
+// Return value:
+//   *Chromatogram: The total intensity of all selected peaks and the
+//     retention time of each level 1 scan. Scans without mobility
+//     information have an intensity of 0.
+func (r *RawData) MobilitySic(minMz float64, maxMz float64,
+	minMobility float64, maxMobility float64) *Chromatogram {
+	c := r.newChromatogram(SicChromatogram, 1, 0)
+	c.MzRange[0], c.MzRange[1] = minMz, maxMz
+	c.MobilityRange[0], c.MobilityRange[1] = minMobility, maxMobility
+	var sum float64
+	for _, s := range r.Scans {
+		if s.MsLevel == 1 {
+			sum = 0.0
+			if s.HasMobility() {
+				for i, v := range s.MzArray {
+					mobility := s.PeakMobility(i)
+					if v > minMz && v < maxMz && mobility >= minMobility &&
+						mobility <= maxMobility {
+						sum += s.IntensityArray[i]
+					}
+				}
+			}
+			c.TimeArray = append(c.TimeArray, s.RetentionTime)
+			c.IntensityArray = append(c.IntensityArray, sum)
+		}
+	}
+	return &c
+}
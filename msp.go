@@ -0,0 +1,440 @@
+//  Copyright 2013 Thomas McGrew
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package mzlib
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Represents a spectrum in a spectral library. Any fields of the entry which
+// do not map to the Scan or to Name, Formula or Adduct are kept in Metadata.
+type LibraryEntry struct {
+	Name     string
+	Formula  string
+	Adduct   string
+	Metadata Params
+	Scan     Scan
+}
+
+// A spectral library, indexed by precursor m/z
+type Library struct {
+	Entries []LibraryEntry
+	index   []int
+}
+
+// A library entry matching a query scan
+type LibraryHit struct {
+	Entry *LibraryEntry
+	Similarity
+}
+
+// Creates a Library containing the given entries
+//
+// Parameters:
+//   entries: The entries of the library
+//
+// Return value:
+//   *Library: The new Library
+func NewLibrary(entries []LibraryEntry) *Library {
+	l := &Library{Entries: entries}
+	l.Reindex()
+	return l
+}
+
+// Rebuilds the precursor m/z index of the library. This must be called after
+// the Entries are modified directly.
+func (l *Library) Reindex() {
+	l.index = make([]int, len(l.Entries))
+	for i := range l.index {
+		l.index[i] = i
+	}
+	sort.SliceStable(l.index, func(i, j int) bool {
+		return l.Entries[l.index[i]].Scan.PrecursorMz <
+			l.Entries[l.index[j]].Scan.PrecursorMz
+	})
+}
+
+// Adds an entry to the library
+//
+// Parameters:
+//   entry: The entry to add
+func (l *Library) Add(entry LibraryEntry) {
+	l.Entries = append(l.Entries, entry)
+	i := len(l.Entries) - 1
+	position := sort.Search(len(l.index), func(k int) bool {
+		return l.Entries[l.index[k]].Scan.PrecursorMz > entry.Scan.PrecursorMz
+	})
+	l.index = append(l.index, 0)
+	copy(l.index[position+1:], l.index[position:])
+	l.index[position] = i
+}
+
+// Finds the entries with a precursor m/z within the tolerance of a value
+//
+// Parameters:
+//   mz: The precursor m/z value
+//   tolerance: The tolerance for matching the precursor m/z
+//
+// Return value:
+//   []*LibraryEntry: The matching entries, sorted by precursor m/z
+func (l *Library) Candidates(mz float64,
+	tolerance Tolerance) []*LibraryEntry {
+	if len(l.index) != len(l.Entries) {
+		l.Reindex()
+	}
+	minMz, maxMz := tolerance.Range(mz)
+	candidates := make([]*LibraryEntry, 0)
+	for k := sort.Search(len(l.index), func(k int) bool {
+		return l.Entries[l.index[k]].Scan.PrecursorMz >= minMz
+	}); k < len(l.index); k++ {
+		entry := &l.Entries[l.index[k]]
+		if entry.Scan.PrecursorMz > maxMz {
+			break
+		}
+		candidates = append(candidates, entry)
+	}
+	return candidates
+}
+
+// Searches the library for the entries most similar to a query scan
+//
+// Parameters:
+//   query: The scan to search for
+//   precursorTolerance: The tolerance for matching the precursor m/z of the
+//     query to the library entries
+//   score: The function comparing the query to each candidate, such as
+//     func(a, b *Scan) Similarity { return a.Cosine(b, Da(0.01), SqrtTransform) }
+//   n: The maximum number of hits to return
+//
+// Return value:
+//   []LibraryHit: The hits with the highest scores, best first
+func (l *Library) Search(query *Scan, precursorTolerance Tolerance,
+	score func(query *Scan, reference *Scan) Similarity,
+	n int) []LibraryHit {
+	hits := make([]LibraryHit, 0)
+	for _, entry := range l.Candidates(query.PrecursorMz, precursorTolerance) {
+		hits = append(hits, LibraryHit{entry, score(query, &entry.Scan)})
+	}
+	sort.SliceStable(hits, func(i, j int) bool {
+		return hits[i].Score > hits[j].Score
+	})
+	if len(hits) > n {
+		hits = hits[:n]
+	}
+	return hits
+}
+
+// Reads a spectral library from a file in NIST MSP format
+//
+// Parameters:
+//   filename: The name of the file to read
+//
+// Return values:
+//   *Library: The library
+//   error: Indicates whether or not an error occurred while reading the file
+func ReadMsp(filename string) (*Library, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return DecodeMsp(file)
+}
+
+// Decodes a spectral library in NIST MSP format. The peaks of an entry end
+// after the number given by its Num Peaks field, at a blank line or at the
+// next field, so entries need not be separated by blank lines.
+//
+// Parameters:
+//   reader: The reader to read the library from
+//
+// Return values:
+//   *Library: The library
+//   error: Indicates whether or not an error occurred while decoding
+func DecodeMsp(reader io.Reader) (*Library, error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	entries := make([]LibraryEntry, 0)
+	var entry *LibraryEntry
+	peaks := -1
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			entry = nil
+			peaks = -1
+			continue
+		}
+		// a short peak list may be followed by the next entry without a
+		// blank line
+		if peaks >= 0 && mspField(line) {
+			entry = nil
+			peaks = -1
+		}
+		if entry == nil {
+			entries = append(entries, LibraryEntry{})
+			entry = &entries[len(entries)-1]
+			entry.Scan.MsLevel = 2
+			entry.Scan.Id = uint64(len(entries))
+		}
+		if peaks >= 0 {
+			if err := entry.Scan.addMspPeaks(line); err != nil {
+				return nil, errors.New(fmt.Sprintf("Line %d: %s", lineNumber,
+					err))
+			}
+			if len(entry.Scan.MzArray) >= peaks {
+				entry = nil
+				peaks = -1
+			}
+			continue
+		}
+		colon := strings.Index(line, ":")
+		if colon < 0 {
+			return nil, errors.New(fmt.Sprintf("Line %d: Expected a field: %s",
+				lineNumber, line))
+		}
+		key := strings.TrimSpace(line[:colon])
+		value := strings.TrimSpace(line[colon+1:])
+		if mspKey(key) == "numpeaks" {
+			var err error
+			if peaks, err = strconv.Atoi(value); err != nil {
+				return nil, errors.New(fmt.Sprintf("Line %d: Invalid %s: %s",
+					lineNumber, key, value))
+			}
+			entry.Scan.MzArray = make([]float64, 0, peaks)
+			entry.Scan.IntensityArray = make([]float64, 0, peaks)
+			if peaks == 0 {
+				entry = nil
+				peaks = -1
+			}
+			continue
+		}
+		entry.setMspField(key, value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return NewLibrary(entries), nil
+}
+
+// Writes the library to a file in NIST MSP format
+//
+// Parameters:
+//   filename: The name of the file to write
+//
+// Return value:
+//   error: Indicates whether or not an error occurred while writing the file
+func (l *Library) WriteMsp(filename string) error {
+	outFile, err := os.OpenFile(filename,
+		os.O_WRONLY|os.O_CREATE|os.O_TRUNC,
+		0770)
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(outFile)
+	defer outFile.Close()
+	err = l.EncodeMsp(out)
+	if err != nil {
+		return err
+	}
+	return out.Flush()
+}
+
+// Encodes the library in NIST MSP format
+//
+// Parameters:
+//   writer: The writer to write the library to
+//
+// Return value:
+//   error: Indicates whether or not an error occurred while writing
+func (l *Library) EncodeMsp(writer io.Writer) error {
+	for i := range l.Entries {
+		e := &l.Entries[i]
+		s := &e.Scan
+		fields := []string{"Name: " + e.Name}
+		if e.Adduct != "" {
+			fields = append(fields, "Precursor_type: "+e.Adduct)
+		}
+		if e.Formula != "" {
+			fields = append(fields, "Formula: "+e.Formula)
+		}
+		if s.PrecursorMz != 0 {
+			fields = append(fields, "PrecursorMZ: "+mspFloat(s.PrecursorMz))
+		}
+		if s.PrecursorCharge != 0 {
+			fields = append(fields,
+				fmt.Sprintf("Charge: %d", s.PrecursorCharge))
+		}
+		if s.Polarity > 0 {
+			fields = append(fields, "Ion_mode: P")
+		} else if s.Polarity < 0 {
+			fields = append(fields, "Ion_mode: N")
+		}
+		fields = append(fields, fmt.Sprintf("Spectrum_type: MS%d", s.MsLevel))
+		if s.CollisionEnergy != 0 {
+			fields = append(fields,
+				"Collision_energy: "+mspFloat(s.CollisionEnergy))
+		}
+		if s.RetentionTime != 0 {
+			fields = append(fields,
+				"RetentionTime: "+mspFloat(s.RetentionTime))
+		}
+		for _, p := range e.Metadata {
+			fields = append(fields, p.Name+": "+p.Value)
+		}
+		fields = append(fields, fmt.Sprintf("Num Peaks: %d", len(s.MzArray)))
+		for j, v := range s.MzArray {
+			fields = append(fields,
+				mspFloat(v)+"\t"+mspFloat(s.IntensityArray[j]))
+		}
+		_, err := fmt.Fprintf(writer, "%s\n\n", strings.Join(fields, "\n"))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sets a field of the library entry from an MSP field
+func (e *LibraryEntry) setMspField(key string, value string) {
+	s := &e.Scan
+	switch mspKey(key) {
+	case "name":
+		e.Name = value
+		return
+	case "formula":
+		e.Formula = value
+		return
+	case "precursortype", "adduct":
+		e.Adduct = value
+		return
+	case "precursormz":
+		if v, err := strconv.ParseFloat(value, 64); err == nil {
+			p := Precursor{Mz: v, Charge: s.PrecursorCharge,
+				CollisionEnergy: s.CollisionEnergy}
+			s.Precursors = nil
+			s.AddPrecursor(p)
+			return
+		}
+	case "charge":
+		sign := int64(1)
+		if strings.HasSuffix(value, "-") {
+			sign = -1
+		}
+		value := strings.TrimSuffix(strings.TrimSuffix(value, "+"), "-")
+		if v, err := strconv.ParseInt(value, 10, 8); err == nil {
+			v *= sign
+			s.PrecursorCharge = int8(v)
+			if len(s.Precursors) > 0 {
+				s.Precursors[0].Charge = int8(v)
+			}
+			return
+		}
+	case "ionmode":
+		switch strings.ToLower(value) {
+		case "p", "positive":
+			s.Polarity = 1
+			return
+		case "n", "negative":
+			s.Polarity = -1
+			return
+		}
+	case "spectrumtype":
+		if v, err := strconv.ParseUint(strings.TrimPrefix(
+			strings.ToUpper(value), "MS"), 10, 8); err == nil {
+			s.MsLevel = uint8(v)
+			return
+		}
+	case "collisionenergy":
+		if v, err := strconv.ParseFloat(value, 64); err == nil {
+			s.CollisionEnergy = v
+			if len(s.Precursors) > 0 {
+				s.Precursors[0].CollisionEnergy = v
+			}
+			return
+		}
+	case "retentiontime":
+		if v, err := strconv.ParseFloat(value, 64); err == nil {
+			s.RetentionTime = v
+			return
+		}
+	}
+	e.Metadata.Add(Param{Name: key, Value: value})
+}
+
+// Adds the peaks on a line of an MSP file to the scan. Peaks are separated by
+// semicolons or new lines, and any annotation after the intensity is
+// ignored.
+func (s *Scan) addMspPeaks(line string) error {
+	for _, peak := range strings.Split(line, ";") {
+		if quote := strings.Index(peak, "\""); quote >= 0 {
+			peak = peak[:quote]
+		}
+		values := strings.FieldsFunc(peak, func(r rune) bool {
+			return r == ' ' || r == '\t' || r == ','
+		})
+		if len(values) == 0 {
+			continue
+		}
+		if len(values) < 2 {
+			return errors.New(fmt.Sprintf("Invalid peak: %s", peak))
+		}
+		mz, err := strconv.ParseFloat(values[0], 64)
+		if err != nil {
+			return errors.New(fmt.Sprintf("Invalid m/z value: %s", values[0]))
+		}
+		intensity, err := strconv.ParseFloat(values[1], 64)
+		if err != nil {
+			return errors.New(fmt.Sprintf("Invalid intensity: %s", values[1]))
+		}
+		s.MzArray = append(s.MzArray, mz)
+		s.IntensityArray = append(s.IntensityArray, intensity)
+	}
+	return nil
+}
+
+// Returns whether a line of an MSP file is a field rather than a line of
+// peaks, which start with a number and may contain a colon in an annotation.
+func mspField(line string) bool {
+	colon := strings.Index(line, ":")
+	if colon <= 0 {
+		return false
+	}
+	_, err := strconv.ParseFloat(strings.Fields(line[:colon])[0], 64)
+	return err != nil
+}
+
+// Normalizes the key of an MSP field for comparison
+func mspKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(key))
+}
+
+// Formats a number for an MSP file
+func mspFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -28,15 +28,22 @@ import (
 )
 
 type mzData struct {
-	SourceFile          string    `xml:"description>admin>sourceFile>nameOfFile"`
-	SourcePath          string    `xml:"description>admin>sourceFile>pathToFile"`
-	InstrumentName      string    `xml:"description>instrument>instrumentName"`
-	MassAnalyzer        []cvParam `xml:"description>instrument>analyzerList>analyzer>cvParam"`
-	ProcessingSoftware  string    `xml:"description>dataProcessing>software>name"`
-	ProcessingSwVersion string    `xml:"description>dataProcessing>software>version"`
-	Detector            []cvParam `xml:"description>instrument>detector>cvParam"`
-	ProcessingMethod    []cvParam `xml:"description>dataProcessing>processingMethod>cvParam"`
-	SpectrumList        struct {
+	SourceFile           string      `xml:"description>admin>sourceFile>nameOfFile"`
+	SourcePath           string      `xml:"description>admin>sourceFile>pathToFile"`
+	InstrumentName       string      `xml:"description>instrument>instrumentName"`
+	Source               []cvParam   `xml:"description>instrument>source>cvParam"`
+	SourceUserParams     []userParam `xml:"description>instrument>source>userParam"`
+	MassAnalyzer         []cvParam   `xml:"description>instrument>analyzerList>analyzer>cvParam"`
+	AnalyzerUserParams   []userParam `xml:"description>instrument>analyzerList>analyzer>userParam"`
+	Detector             []cvParam   `xml:"description>instrument>detector>cvParam"`
+	DetectorUserParams   []userParam `xml:"description>instrument>detector>userParam"`
+	Additional           []cvParam   `xml:"description>instrument>additional>cvParam"`
+	AdditionalUserParams []userParam `xml:"description>instrument>additional>userParam"`
+	ProcessingSoftware   string      `xml:"description>dataProcessing>software>name"`
+	ProcessingSwVersion  string      `xml:"description>dataProcessing>software>version"`
+	ProcessingMethod     []cvParam   `xml:"description>dataProcessing>processingMethod>cvParam"`
+	ProcessingUserParams []userParam `xml:"description>dataProcessing>processingMethod>userParam"`
+	SpectrumList         struct {
 		Scans     []mzDataScan `xml:"spectrum"`
 		ScanCount uint64       `xml:"count,attr"`
 	} `xml:"spectrumList"`
@@ -45,22 +52,31 @@ type mzData struct {
 type mzDataScan struct {
 	Id         uint64 `xml:"id,attr"`
 	Instrument struct {
-		MsLevel uint8     `xml:"msLevel,attr"`
-		MzMin   float64   `xml:"mzRangeStart,attr"`
-		MzMax   float64   `xml:"mzRangeStop,attr"`
-		Params  []cvParam `xml:"cvParam"`
+		MsLevel    uint8       `xml:"msLevel,attr"`
+		MzMin      float64     `xml:"mzRangeStart,attr"`
+		MzMax      float64     `xml:"mzRangeStop,attr"`
+		Params     []cvParam   `xml:"cvParam"`
+		UserParams []userParam `xml:"userParam"`
 	} `xml:"spectrumDesc>spectrumSettings>spectrumInstrument"`
 	Specification struct {
 		SpectrumType        string `xml:"spectrumType,attr"`
 		MethodOfCombination string `xml:"methodOfCombination,attr"`
 	} `xml:"spectrumDesc>acqSpecification"`
-	Precursor []struct {
-		ParentScan   uint64    `xml:"spectrumRef,attr"`
-		IonSelection []cvParam `xml:"ionSelection>cvParam"`
-		Activation   []cvParam `xml:"activation>cvParam"`
-	} `xml:"spectrumDesc>precursorList>precursor"`
-	MzArray        peakArray `xml:"mzArrayBinary>data"`
-	IntensityArray peakArray `xml:"intenArrayBinary>data"`
+	Precursor      []mzDataPrecursor `xml:"spectrumDesc>precursorList>precursor"`
+	MzArray        peakArray         `xml:"mzArrayBinary>data"`
+	IntensityArray peakArray         `xml:"intenArrayBinary>data"`
+	SupArrays      []struct {
+		Name string    `xml:"arrayName"`
+		Data peakArray `xml:"data"`
+	} `xml:"supDataArrayBinary"`
+}
+
+type mzDataPrecursor struct {
+	ParentScan             uint64      `xml:"spectrumRef,attr"`
+	IonSelection           []cvParam   `xml:"ionSelection>cvParam"`
+	IonSelectionUserParams []userParam `xml:"ionSelection>userParam"`
+	Activation             []cvParam   `xml:"activation>cvParam"`
+	ActivationUserParams   []userParam `xml:"activation>userParam"`
 }
 
 type peakArray struct {
@@ -77,6 +93,41 @@ type cvParam struct {
 	Value     string `xml:"value,attr"`
 }
 
+type userParam struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// The names used by the mzData vocabulary for the terms which are matched by
+// name when a cvParam has no accession.
+var mzDataNames = map[string]string{
+	"IonizationType":      "PSI:1000008",
+	"AnalyzerType":        "PSI:1000010",
+	"DetectorType":        "PSI:1000026",
+	"SamplingFrequency":   "PSI:1000029",
+	"Deisotoping":         "PSI:1000033",
+	"ChargeDeconvolution": "PSI:1000034",
+	"PeakProcessing":      "PSI:1000035",
+	"ScanMode":            "PSI:1000036",
+	"Polarity":            "PSI:1000037",
+	"TimeInMinutes":       "PSI:1000038",
+	"TimeInSeconds":       "PSI:1000039",
+	"MassToChargeRatio":   "PSI:1000040",
+	"ChargeState":         "PSI:1000041",
+	"Intensity":           "PSI:1000042",
+	"Method":              "PSI:1000044",
+	"CollisionEnergy":     "PSI:1000045",
+}
+
+// Returns the accession of a cvParam, looking it up by its mzData name when
+// the accession is missing.
+func (v *cvParam) accession() string {
+	if v.Accession == "" {
+		return mzDataNames[v.Name]
+	}
+	return v.Accession
+}
+
 // Reads data from an MzData file
 //
 // Paramters:
@@ -118,7 +169,26 @@ func (r *RawData) DecodeMzData(reader io.Reader) error {
 	r.SourceFile = strings.Join([]string{mz.SourcePath, mz.SourceFile}, "/")
 	r.Instrument.Model = mz.InstrumentName
 	r.Instrument.Manufacturer = mz.InstrumentName
-	r.Instrument.MassAnalyzer, _ = param(&mz.MassAnalyzer, "AnalyzerType")
+	r.Instrument.MassAnalyzer, _ = paramIsA(&mz.MassAnalyzer, "PSI:1000010",
+		"MS:1000443")
+	r.Instrument.Detector, _ = paramIsA(&mz.Detector, "PSI:1000026",
+		"MS:1000026")
+	r.Instrument.Ionization, _ = paramIsA(&mz.Source, "PSI:1000008",
+		"MS:1000008")
+	r.Instrument.SourceParams = nil
+	r.Instrument.SourceParams.addMzData(mz.Source, mz.SourceUserParams,
+		"PSI:1000008")
+	r.Instrument.AnalyzerParams = nil
+	r.Instrument.AnalyzerParams.addMzData(mz.MassAnalyzer, mz.AnalyzerUserParams,
+		"PSI:1000010")
+	r.Instrument.DetectorParams = nil
+	r.Instrument.DetectorParams.addMzData(mz.Detector, mz.DetectorUserParams,
+		"PSI:1000026")
+	r.Instrument.Params = nil
+	r.Instrument.Params.addMzData(mz.Additional, mz.AdditionalUserParams)
+	r.Params = nil
+	r.Params.addMzData(mz.ProcessingMethod, mz.ProcessingUserParams,
+		"PSI:1000033")
 	r.ScanCount = mz.SpectrumList.ScanCount
 	// copy scan information
 	var chans []chan *Scan
@@ -130,7 +200,7 @@ func (r *RawData) DecodeMzData(reader io.Reader) error {
 	// wait for everything to finish
 	for _, c := range chans {
 		s := <-c
-		iso, _ := param(&mz.ProcessingMethod, "Deisotoping")
+		iso, _ := param(&mz.ProcessingMethod, "PSI:1000033")
 		// sanity check
 		if len(s.MzArray) != len(s.IntensityArray) {
 			panic(fmt.Sprintf(
@@ -145,9 +215,9 @@ func (r *RawData) DecodeMzData(reader io.Reader) error {
 
 func (scan *mzDataScan) scanInfo(c chan *Scan) {
 	s := new(Scan)
-	rt, _ := param(&scan.Instrument.Params, "TimeInMinutes")
+	rt, _ := param(&scan.Instrument.Params, "PSI:1000038")
 	s.RetentionTime, _ = strconv.ParseFloat(rt, 64)
-	if p, _ := param(&scan.Instrument.Params, "Polarity"); p == "positive" {
+	if p, _ := param(&scan.Instrument.Params, "PSI:1000037"); p == "positive" {
 		s.Polarity = 1
 	} else {
 		s.Polarity = -1
@@ -156,12 +226,10 @@ func (scan *mzDataScan) scanInfo(c chan *Scan) {
 	s.Id = scan.Id
 	s.MzRange[0] = scan.Instrument.MzMin
 	s.MzRange[1] = scan.Instrument.MzMax
-	if len(scan.Precursor) > 0 {
-		s.ParentScan = scan.Precursor[0].ParentScan
-		mass, _ := param(&scan.Precursor[0].IonSelection, "MassToChargeRatio")
-		s.PrecursorMz, _ = strconv.ParseFloat(mass, 64)
-		ce, _ := param(&scan.Precursor[0].Activation, "CollisionEnergy")
-		s.CollisionEnergy, _ = strconv.ParseFloat(ce, 64)
+	s.Params.addMzData(scan.Instrument.Params, scan.Instrument.UserParams,
+		"PSI:1000038", "PSI:1000037")
+	for i := range scan.Precursor {
+		s.AddPrecursor(scan.Precursor[i].precursor())
 	}
 	s.Continuous = scan.Specification.SpectrumType == "continuous"
 	var byteOrder binary.ByteOrder
@@ -177,6 +245,16 @@ func (scan *mzDataScan) scanInfo(c chan *Scan) {
 		scan.IntensityArray.PeakCount,
 		scan.IntensityArray.Precision,
 		false, byteOrder)
+	for _, v := range scan.SupArrays {
+		byteOrder = binary.LittleEndian
+		if v.Data.Endian == "big" {
+			byteOrder = binary.BigEndian
+		}
+		a := NewDataArray(v.Name, nil)
+		_ = Float64FromBase64(&a.Values, v.Data.PeakList, v.Data.PeakCount,
+			v.Data.Precision, false, byteOrder)
+		s.ExtraArrays = append(s.ExtraArrays, a)
+	}
 	c <- s
 }
 
@@ -215,6 +293,32 @@ func (r *RawData) EncodeMzData(writer io.Writer) error {
 	} else {
 		sourceFileName = r.Filename
 	}
+	// fill in defaults for any required parameters which were not decoded
+	samplingFrequency := fmt.Sprintf(`
+          <cvParam cvLabel="psi" accession="PSI:1000029" name="SamplingFrequency" value="%s" />`,
+		"unknown")
+	if p, err := r.Instrument.DetectorParams.Get("PSI:1000029"); err == nil {
+		samplingFrequency = (&Params{*p}).mzData("          ")
+	} else if p, err := r.Instrument.Params.Get("PSI:1000029"); err == nil {
+		samplingFrequency = (&Params{*p}).mzData("          ")
+	}
+	processing := ""
+	if _, err := r.Params.Get("PSI:1000034"); err != nil {
+		processing += `
+          <cvParam cvLabel="psi" accession="PSI:1000034" name="ChargeDeconvolution" value="unknown" />`
+	}
+	if _, err := r.Params.Get("PSI:1000035"); err != nil {
+		processing += `
+          <cvParam cvLabel="psi" accession="PSI:1000035" name="PeakProcessing" value="unknown" />`
+	}
+	processing += r.Params.mzData("          ", "PSI:1000033")
+	source := ""
+	if r.Instrument.Ionization != "" {
+		source = fmt.Sprintf(`
+          <cvParam cvLabel="psi" accession="PSI:1000008" name="IonizationType" value="%s" />`,
+			escape(r.Instrument.Ionization))
+	}
+	source += r.Instrument.SourceParams.mzData("          ", "PSI:1000008")
 	_, err := writer.Write(([]byte)(fmt.Sprintf(
 		`<?xml version="1.0" encoding="UTF-8"?>
 <mzData version="1.05" accessionNumber="psi-ms:100" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
@@ -235,16 +339,18 @@ func (r *RawData) EncodeMzData(writer io.Writer) error {
     </admin>
     <instrument>
       <instrumentName>%s</instrumentName>
-      <source />
+      <source>%s
+      </source>
       <analyzerList count="1">
         <analyzer>
-          <cvParam cvLabel="psi" accession="PSI:1000010" name="AnalyzerType" value="%s" />
+          <cvParam cvLabel="psi" accession="PSI:1000010" name="AnalyzerType" value="%s" />%s
         </analyzer>
       </analyzerList>
       <detector>
-          <cvParam cvLabel="psi" accession="PSI:1000026" name="DetectorType" value="unknown" />
-          <cvParam cvLabel="psi" accession="PSI:1000029" name="SamplingFrequency" value="unknown" />
+          <cvParam cvLabel="psi" accession="PSI:1000026" name="DetectorType" value="%s" />%s%s
       </detector>
+      <additional>%s
+      </additional>
     </instrument>
     <dataProcessing>
       <software>
@@ -253,18 +359,27 @@ func (r *RawData) EncodeMzData(writer io.Writer) error {
         <comments />
       </software>
       <processingMethod>
-          <cvParam cvLabel="psi" accession="PSI:1000033" name="deisotoped" value="%t" />
-          <cvParam cvLabel="psi" accession="PSI:1000034" name="chargeDeconvolved" value="unknown" />
-          <cvParam cvLabel="psi" accession="PSI:1000035" name="peakProcessing" value="unknown" />
+          <cvParam cvLabel="psi" accession="PSI:1000033" name="Deisotoping" value="%t" />%s
       </processingMethod>
     </dataProcessing>
   </description>
-  <spectrumList count="%d">`, sourceFileName, sourceFilePath,
-		r.Instrument.Model, r.Instrument.MassAnalyzer, Version, Version,
-		deIsotoped, len(r.Scans))))
+  <spectrumList count="%d">`, sourceFileName, sourceFilePath, escape(r.Instrument.Model),
+		source,
+		escape(r.Instrument.MassAnalyzer),
+		r.Instrument.AnalyzerParams.mzData("          ", "PSI:1000010"),
+		escape(orUnknown(r.Instrument.Detector)), samplingFrequency,
+		r.Instrument.DetectorParams.mzData("          ", "PSI:1000026",
+			"PSI:1000029"),
+		r.Instrument.Params.mzData("          ", "PSI:1000029"),
+		Version, Version, deIsotoped, processing, len(r.Scans))))
 	if err != nil {
 		return err
 	}
+	// the ms level of each scan, for the msLevel of its precursors
+	msLevels := make(map[uint64]uint8, len(r.Scans))
+	for _, scan := range r.Scans {
+		msLevels[scan.Id] = scan.MsLevel
+	}
 	for _, scan := range r.Scans {
 		var polarity string
 		if scan.Polarity > 0 {
@@ -275,6 +390,11 @@ func (r *RawData) EncodeMzData(writer io.Writer) error {
 		mzBase64 := Base64FromFloat64(&scan.MzArray, 64, binary.LittleEndian)
 		intensityBase64 := Base64FromFloat64(&scan.IntensityArray, 64,
 			binary.LittleEndian)
+		scanMode := `
+              <cvParam cvLabel="psi" accession="PSI:1000036" name="ScanMode" value="Scan" />`
+		if p, err := scan.Params.Get("PSI:1000036"); err == nil {
+			scanMode = (&Params{*p}).mzData("              ")
+		}
 		var spectrumType string
 		method := ""
 		if scan.Continuous {
@@ -290,44 +410,70 @@ func (r *RawData) EncodeMzData(writer io.Writer) error {
             <acqSpecification spectrumType="%s"%s count="1">
               <acquisition number="%d" />
             </acqSpecification>
-            <spectrumInstrument msLevel="%d" mzRangeStart="%f" mzRangeStop="%f">
-              <cvParam cvLabel="psi" accession="PSI:1000036" name="ScanMode" value="Scan" />
+            <spectrumInstrument msLevel="%d" mzRangeStart="%f" mzRangeStop="%f">%s
               <cvParam cvLabel="psi" accession="PSI:1000037" name="Polarity" value="%s" />
-              <cvParam cvLabel="psi" accession="PSI:1000038" name="TimeInMinutes" value="%f" />
+              <cvParam cvLabel="psi" accession="PSI:1000038" name="TimeInMinutes" value="%f" />%s
             </spectrumInstrument>
           </spectrumSettings>`, scan.Id, spectrumType, method, scan.Id,
-			scan.MsLevel, scan.MzRange[0], scan.MzRange[1], polarity,
-			scan.RetentionTime)))
+			scan.MsLevel, scan.MzRange[0], scan.MzRange[1], scanMode, polarity,
+			scan.RetentionTime, scan.Params.mzData("              ",
+				"PSI:1000036"))))
 		if err != nil {
 			return err
 		}
-		if scan.ParentScan != 0 {
+		if precursors := scan.precursors(); len(precursors) > 0 {
 			_, err = writer.Write(([]byte)(fmt.Sprintf(`
-				<precursorList count = "1">
-					<precursor msLevel="%d" spectrumRef="%d">
-						<ionSelection>
-							<cvParam cvLabel="psi" accession="PSI:1000040" name="MassToChargeRatio" value="%f"/>
-						</ionSelection>
-						<activation>
-							<cvParam cvLabel="psi" accession="PSI:1000045" name="CollisionEnergy" value="%f"/>
-						</activation>
-					</precursor>
-				</precursorList>`, scan.MsLevel-1, scan.ParentScan, scan.PrecursorMz,
-				scan.CollisionEnergy)))
+				<precursorList count = "%d">`, len(precursors))))
+			if err != nil {
+				return err
+			}
+			for i := range precursors {
+				msLevel, ok := msLevels[precursors[i].ParentScan]
+				if !ok || precursors[i].ParentScan == 0 {
+					msLevel = 1
+					if scan.MsLevel > 1 {
+						msLevel = scan.MsLevel - 1
+					}
+				}
+				err = precursors[i].encodeMzData(writer, msLevel)
+				if err != nil {
+					return err
+				}
+			}
+			_, err = writer.Write(([]byte)(`
+				</precursorList>`))
 			if err != nil {
 				return err
 			}
 		}
+		supDesc := ""
+		supArrays := ""
+		for i, a := range scan.ExtraArrays {
+			if a.Accession != "" {
+				supDesc += fmt.Sprintf(`
+        <supDesc supDataArrayRef="%d">
+          <supDataDesc>
+            <cvParam cvLabel="MS" accession="%s" name="%s" value="" />
+          </supDataDesc>
+        </supDesc>`, i+1, escape(a.Accession), escape(a.Name))
+			}
+			supArrays += fmt.Sprintf(`
+        <supDataArrayBinary id="%d">
+          <arrayName>%s</arrayName>
+          <data precision="64" endian="little" length="%d">%s</data>
+        </supDataArrayBinary>`, i+1, escape(a.Name), len(a.Values),
+				Base64FromFloat64(&a.Values, 64, binary.LittleEndian))
+		}
 		_, err = writer.Write(([]byte)(fmt.Sprintf(`
-        </spectrumDesc>
+        </spectrumDesc>%s
         <mzArrayBinary>
           <data precision="64" endian="little" length="%d">%s</data>
         </mzArrayBinary>
         <intenArrayBinary>
           <data precision="64" endian="little" length="%d">%s</data>
-        </intenArrayBinary>
-      </spectrum>`, len(scan.MzArray), mzBase64, len(scan.IntensityArray),
-			intensityBase64)))
+        </intenArrayBinary>%s
+      </spectrum>`, supDesc, len(scan.MzArray), mzBase64,
+			len(scan.IntensityArray), intensityBase64, supArrays)))
 		if err != nil {
 			return err
 		}
@@ -341,20 +487,181 @@ func (r *RawData) EncodeMzData(writer io.Writer) error {
 	return nil
 }
 
+// Converts the precursor information read from a file to a Precursor
+func (m *mzDataPrecursor) precursor() Precursor {
+	p := Precursor{ParentScan: m.ParentScan}
+	mz, err := param(&m.IonSelection, "PSI:1000040")
+	if err != nil {
+		mz, _ = param(&m.IonSelection, "MS:1000744")
+	}
+	p.Mz, _ = strconv.ParseFloat(mz, 64)
+	charge, _ := param(&m.IonSelection, "PSI:1000041")
+	c, _ := strconv.ParseInt(charge, 10, 8)
+	p.Charge = int8(c)
+	intensity, _ := param(&m.IonSelection, "PSI:1000042")
+	p.Intensity, _ = strconv.ParseFloat(intensity, 64)
+	for _, v := range m.IonSelection {
+		if PsiMs.Matches("MS:1000633", v.accession(), v.Name) {
+			c, _ := strconv.ParseInt(v.Value, 10, 8)
+			p.PossibleCharges = append(p.PossibleCharges, int8(c))
+		}
+	}
+	target, err := param(&m.IonSelection, "MS:1000827")
+	if err != nil {
+		p.IsolationTarget = p.Mz
+	} else {
+		p.IsolationTarget, _ = strconv.ParseFloat(target, 64)
+	}
+	lower, _ := param(&m.IonSelection, "MS:1000828")
+	p.IsolationLowerOffset, _ = strconv.ParseFloat(lower, 64)
+	upper, _ := param(&m.IonSelection, "MS:1000829")
+	p.IsolationUpperOffset, _ = strconv.ParseFloat(upper, 64)
+	method, _ := paramIsA(&m.Activation, "PSI:1000044", "MS:1000044")
+	p.ActivationMethod = activationMethod(method)
+	ce, _ := param(&m.Activation, "PSI:1000045")
+	p.CollisionEnergy, _ = strconv.ParseFloat(ce, 64)
+
+	p.SelectedIonParams.addMzData(m.IonSelection, m.IonSelectionUserParams,
+		"PSI:1000040", "MS:1000744", "PSI:1000041", "PSI:1000042",
+		"MS:1000633", "MS:1000827", "MS:1000828", "MS:1000829")
+	var activation []cvParam
+	for _, v := range m.Activation {
+		if v.accession() == "" || !PsiMs.IsA(v.accession(), "MS:1000044") {
+			activation = append(activation, v)
+		}
+	}
+	p.ActivationParams.addMzData(activation, m.ActivationUserParams,
+		"PSI:1000045")
+	return p
+}
+
+// Writes a precursor element in MzData format
+//
+// Parameters:
+//   writer: The writer to write the element to
+//   msLevel: The ms level of the precursor
+//
+// Return value:
+//   error: Indicates whether or not an error occurred while writing
+func (p *Precursor) encodeMzData(writer io.Writer, msLevel uint8) error {
+	ionSelection := ""
+	if p.Charge != 0 {
+		ionSelection += fmt.Sprintf(`
+							<cvParam cvLabel="psi" accession="PSI:1000041" name="ChargeState" value="%d"/>`,
+			p.Charge)
+	}
+	if p.Intensity != 0 {
+		ionSelection += fmt.Sprintf(`
+							<cvParam cvLabel="psi" accession="PSI:1000042" name="Intensity" value="%f"/>`,
+			p.Intensity)
+	}
+	for _, v := range p.PossibleCharges {
+		ionSelection += fmt.Sprintf(`
+							<cvParam cvLabel="MS" accession="MS:1000633" name="possible charge state" value="%d"/>`,
+			v)
+	}
+	if p.IsolationLowerOffset != 0 || p.IsolationUpperOffset != 0 {
+		ionSelection += fmt.Sprintf(`
+							<cvParam cvLabel="MS" accession="MS:1000827" name="isolation window target m/z" value="%f"/>
+							<cvParam cvLabel="MS" accession="MS:1000828" name="isolation window lower offset" value="%f"/>
+							<cvParam cvLabel="MS" accession="MS:1000829" name="isolation window upper offset" value="%f"/>`,
+			p.IsolationTarget, p.IsolationLowerOffset, p.IsolationUpperOffset)
+	}
+	// mzData has no isolation window element of its own
+	ionSelection += p.IsolationParams.mzData("							")
+	ionSelection += p.SelectedIonParams.mzData("							")
+	activation := ""
+	if p.ActivationMethod != "" {
+		activation = fmt.Sprintf(`
+							<cvParam cvLabel="psi" accession="PSI:1000044" name="Method" value="%s"/>`,
+			escape(p.ActivationMethod))
+	}
+	activation += p.ActivationParams.mzData("							")
+	_, err := writer.Write(([]byte)(fmt.Sprintf(`
+					<precursor msLevel="%d" spectrumRef="%d">
+						<ionSelection>
+							<cvParam cvLabel="psi" accession="PSI:1000040" name="MassToChargeRatio" value="%f"/>%s
+						</ionSelection>
+						<activation>%s
+							<cvParam cvLabel="psi" accession="PSI:1000045" name="CollisionEnergy" value="%f"/>
+						</activation>
+					</precursor>`, msLevel, p.ParentScan, p.Mz, ionSelection,
+		activation, p.CollisionEnergy)))
+	return err
+}
+
 // Reads through a slice of cvParams to find the appropriate value
 //
 // Parameters:
 //   params: A Pointer to the slice of cvParams to search
-//   name: The name of the attribute to search for
+//   accession: The accession of the attribute to search for. Parameters with
+//     a different accession are matched by name using the PsiMs vocabulary.
 //
 // Return values:
 //   string: The attribute's value, or an empty string if not found
 //   error: An error if the attribute was not found
-func param(params *[]cvParam, name string) (string, error) {
+func param(params *[]cvParam, accession string) (string, error) {
 	for _, v := range *params {
-		if v.Name == name {
+		if PsiMs.Matches(accession, v.accession(), v.Name) {
 			return v.Value, nil
 		}
 	}
-	return "", errors.New(fmt.Sprintf("Key '%s' Not Found", name))
+	return "", errors.New(fmt.Sprintf("Key '%s' Not Found", accession))
+}
+
+// Reads through a slice of cvParams to find the value of an attribute, or
+// failing that the name of a parameter which is a kind of the given term.
+//
+// Parameters:
+//   params: A Pointer to the slice of cvParams to search
+//   accession: The accession of the attribute to search for
+//   parent: The accession of the term the parameter should be a kind of
+//
+// Return values:
+//   string: The attribute's value or parameter's name, or an empty string if
+//     not found
+//   error: An error if the attribute was not found
+func paramIsA(params *[]cvParam, accession string,
+	parent string) (string, error) {
+	if value, err := param(params, accession); err == nil {
+		return value, nil
+	}
+	for _, v := range *params {
+		if v.accession() != "" && PsiMs.IsA(v.accession(), parent) {
+			return v.Name, nil
+		}
+	}
+	return "", errors.New(fmt.Sprintf("Key '%s' Not Found", parent))
+}
+
+// Adds mzData cvParams and userParams to a parameter collection
+//
+// Parameters:
+//   cvParams: The cvParams to add
+//   userParams: The userParams to add
+//   exclude: The accessions of any parameters which have already been mapped
+//     to a field and should not be added
+func (p *Params) addMzData(cvParams []cvParam, userParams []userParam,
+	exclude ...string) {
+outer:
+	for _, v := range cvParams {
+		for _, e := range exclude {
+			if PsiMs.Matches(e, v.accession(), v.Name) {
+				continue outer
+			}
+		}
+		p.Add(Param{CvLabel: v.CvLabel, Accession: v.accession(), Name: v.Name,
+			Value: v.Value})
+	}
+	for _, v := range userParams {
+		p.Add(Param{Name: v.Name, Value: v.Value})
+	}
+}
+
+// Returns the given value, or "unknown" if it is empty
+func orUnknown(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+	return value
 }
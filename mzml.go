@@ -15,22 +15,1160 @@
 package mzlib
 
 import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
 	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 )
 
+type mzML struct {
+	FileContent mzMLParamGroup `xml:"fileDescription>fileContent"`
+	SourceFiles []struct {
+		Name     string `xml:"name,attr"`
+		Location string `xml:"location,attr"`
+	} `xml:"fileDescription>sourceFileList>sourceFile"`
+	ParamGroups []struct {
+		Id string `xml:"id,attr"`
+		mzMLParamGroup
+	} `xml:"referenceableParamGroupList>referenceableParamGroup"`
+	Instruments []struct {
+		mzMLParamGroup
+		Sources   []mzMLParamGroup `xml:"componentList>source"`
+		Analyzers []mzMLParamGroup `xml:"componentList>analyzer"`
+		Detectors []mzMLParamGroup `xml:"componentList>detector"`
+	} `xml:"instrumentConfigurationList>instrumentConfiguration"`
+	Processing []mzMLParamGroup `xml:"dataProcessingList>dataProcessing>processingMethod"`
+	Run        struct {
+		SpectrumList struct {
+			Spectra   []mzMLSpectrum `xml:"spectrum"`
+			ScanCount uint64         `xml:"count,attr"`
+		} `xml:"spectrumList"`
+		Chromatograms []mzMLChromatogram `xml:"chromatogramList>chromatogram"`
+	} `xml:"run"`
+}
+
+type mzMLParamGroup struct {
+	Refs []struct {
+		Ref string `xml:"ref,attr"`
+	} `xml:"referenceableParamGroupRef"`
+	CvParams   []mzMLCvParam   `xml:"cvParam"`
+	UserParams []mzMLUserParam `xml:"userParam"`
+}
+
+type mzMLCvParam struct {
+	CvRef         string `xml:"cvRef,attr"`
+	Accession     string `xml:"accession,attr"`
+	Name          string `xml:"name,attr"`
+	Value         string `xml:"value,attr"`
+	UnitAccession string `xml:"unitAccession,attr"`
+	UnitName      string `xml:"unitName,attr"`
+}
+
+type mzMLUserParam struct {
+	Name          string `xml:"name,attr"`
+	Value         string `xml:"value,attr"`
+	UnitAccession string `xml:"unitAccession,attr"`
+	UnitName      string `xml:"unitName,attr"`
+}
+
+type mzMLSpectrum struct {
+	Index              uint64 `xml:"index,attr"`
+	Id                 string `xml:"id,attr"`
+	DefaultArrayLength uint64 `xml:"defaultArrayLength,attr"`
+	mzMLParamGroup
+	ScanList struct {
+		mzMLParamGroup
+		Scans []struct {
+			mzMLParamGroup
+			Windows []mzMLParamGroup `xml:"scanWindowList>scanWindow"`
+		} `xml:"scan"`
+	} `xml:"scanList"`
+	Precursors []mzMLPrecursor   `xml:"precursorList>precursor"`
+	Arrays     []mzMLBinaryArray `xml:"binaryDataArrayList>binaryDataArray"`
+}
+
+type mzMLPrecursor struct {
+	SpectrumRef     string           `xml:"spectrumRef,attr"`
+	IsolationWindow mzMLParamGroup   `xml:"isolationWindow"`
+	SelectedIons    []mzMLParamGroup `xml:"selectedIonList>selectedIon"`
+	Activation      mzMLParamGroup   `xml:"activation"`
+}
+
+type mzMLChromatogram struct {
+	Id                 string `xml:"id,attr"`
+	DefaultArrayLength uint64 `xml:"defaultArrayLength,attr"`
+	mzMLParamGroup
+	Precursor mzMLPrecursor     `xml:"precursor"`
+	Product   mzMLParamGroup    `xml:"product>isolationWindow"`
+	Arrays    []mzMLBinaryArray `xml:"binaryDataArrayList>binaryDataArray"`
+}
+
+type mzMLBinaryArray struct {
+	ArrayLength uint64 `xml:"arrayLength,attr"`
+	mzMLParamGroup
+	Binary string `xml:"binary"`
+}
+
+// The referenceableParamGroups of an mzML file, by id
+type mzMLParamGroups map[string]*mzMLParamGroup
+
+// Reads data from an MzML file
+//
+// Paramters:
+//   filename: The name of the file to read from
+//
+// Return value:
+//   error: Indicates whether or not an error occurred while reading the file
 func (r *RawData) ReadMzMl(filename string) error {
-	return errors.New("Reading this file type has not yet been implemented")
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	r.Filename, _ = filepath.Abs(filename)
+	defer file.Close()
+	reader := io.Reader(file)
+	return r.DecodeMzMl(reader)
 }
 
+// Decodes data from a Reader containing MzML formatted data. Both plain and
+// indexed MzML are supported.
+//
+// Parameters:
+//   reader: The reader to read raw data from
+//
+// Return value:
+//   error: Indicates whether or not an error occurred when reading the data
 func (r *RawData) DecodeMzMl(reader io.Reader) error {
-	return errors.New("Reading this file type has not yet been implemented")
+	mz := mzML{}
+	decoder := xml.NewDecoder(reader)
+	// set up a dummy CharsetReader
+	decoder.CharsetReader =
+		func(charset string, input io.Reader) (io.Reader, error) {
+			return input, nil
+		}
+	// skip over the indexedmzML wrapper, if any
+	for {
+		token, e := decoder.Token()
+		if e == io.EOF {
+			return errors.New("No mzML element found")
+		}
+		if e != nil {
+			return e
+		}
+		if start, ok := token.(xml.StartElement); ok && start.Name.Local == "mzML" {
+			if e = decoder.DecodeElement(&mz, &start); e != nil {
+				return e
+			}
+			break
+		}
+	}
+	groups := make(mzMLParamGroups)
+	for i := range mz.ParamGroups {
+		groups[mz.ParamGroups[i].Id] = &mz.ParamGroups[i].mzMLParamGroup
+	}
+
+	if len(mz.SourceFiles) > 0 {
+		location := strings.TrimPrefix(mz.SourceFiles[0].Location, "file://")
+		r.SourceFile = strings.TrimSuffix(location, "/") + "/" +
+			mz.SourceFiles[0].Name
+	}
+	r.Instrument = Instrument{}
+	if len(mz.Instruments) > 0 {
+		inst := &mz.Instruments[0]
+		params := inst.params(groups)
+		if model, err := params.isA("MS:1000031"); err == nil {
+			r.Instrument.Model = model.Name
+			if model.Accession == "MS:1000031" {
+				r.Instrument.Model = model.Value
+			}
+			// vendor model terms are grouped under a term for the vendor
+			if term, err := PsiMs.Term(model.Accession); err == nil &&
+				len(term.IsA) > 0 && PsiMs.IsA(term.IsA[0], "MS:1000031") {
+				if vendor, err := PsiMs.Term(term.IsA[0]); err == nil &&
+					vendor.Id != "MS:1000031" {
+					r.Instrument.Manufacturer =
+						strings.TrimSuffix(vendor.Name, " instrument model")
+				}
+			}
+			params.remove(model.Accession)
+		} else if len(params) > 0 && params[0].Accession != "" {
+			r.Instrument.Model = params[0].Name
+			params = params[1:]
+		}
+		r.Instrument.Params = params
+		for _, v := range inst.Sources {
+			r.Instrument.Ionization = r.Instrument.SourceParams.addComponent(
+				v.params(groups), "MS:1000008", r.Instrument.Ionization)
+		}
+		for _, v := range inst.Analyzers {
+			r.Instrument.MassAnalyzer = r.Instrument.AnalyzerParams.addComponent(
+				v.params(groups), "MS:1000443", r.Instrument.MassAnalyzer)
+		}
+		for _, v := range inst.Detectors {
+			r.Instrument.Detector = r.Instrument.DetectorParams.addComponent(
+				v.params(groups), "MS:1000026", r.Instrument.Detector)
+		}
+	}
+	r.Params = mz.FileContent.params(groups)
+	deIsotoped := false
+	for i := range mz.Processing {
+		params := mz.Processing[i].params(groups)
+		if _, err := params.Get("MS:1000033"); err == nil {
+			deIsotoped = true
+		}
+	}
+	r.ScanCount = mz.Run.SpectrumList.ScanCount
+
+	// copy scan information
+	var chans []chan *Scan
+	for i := range mz.Run.SpectrumList.Spectra {
+		c := make(chan *Scan)
+		go mz.Run.SpectrumList.Spectra[i].scanInfo(groups, c)
+		chans = append(chans, c)
+	}
+	// wait for everything to finish
+	r.Scans = nil
+	for _, c := range chans {
+		s := <-c
+		// sanity check
+		if len(s.MzArray) != len(s.IntensityArray) {
+			return errors.New(fmt.Sprintf(
+				"Lengths of Intensity and MZ do not match! Scan %d, %d vs %d",
+				s.Id, len(s.IntensityArray), len(s.MzArray)))
+		}
+		s.DeIsotoped = deIsotoped
+		r.Scans = append(r.Scans, *s)
+	}
+	r.Chromatograms = nil
+	for i := range mz.Run.Chromatograms {
+		r.Chromatograms = append(r.Chromatograms,
+			mz.Run.Chromatograms[i].chromatogram(groups))
+	}
+	return nil
+}
+
+// Converts chromatogram information read from a file to a Chromatogram
+//
+// Parameters:
+//   groups: The referenceableParamGroups of the file
+//
+// Return value:
+//   Chromatogram: The decoded chromatogram
+func (m *mzMLChromatogram) chromatogram(groups mzMLParamGroups) Chromatogram {
+	c := Chromatogram{Id: m.Id}
+	params := m.params(groups)
+	if p, err := params.isA("MS:1000626"); err == nil {
+		c.Type = p.Accession
+	}
+	level, _ := params.Value("MS:1000511")
+	msLevel, _ := strconv.ParseUint(level, 10, 8)
+	c.MsLevel = uint8(msLevel)
+	if p, err := params.isA("MS:1000465"); err == nil {
+		if PsiMs.IsA(p.Accession, "MS:1000130") {
+			c.Polarity = 1
+		} else if PsiMs.IsA(p.Accession, "MS:1000129") {
+			c.Polarity = -1
+		}
+	}
+	lower, _ := params.Value("MS:1000501")
+	upper, _ := params.Value("MS:1000500")
+	c.MzRange[0], _ = strconv.ParseFloat(lower, 64)
+	c.MzRange[1], _ = strconv.ParseFloat(upper, 64)
+	params.remove("MS:1000626", "MS:1000511", "MS:1000465", "MS:1000501",
+		"MS:1000500")
+	c.Params = params
+
+	precursors := m.Precursor.precursors(groups)
+	c.PrecursorMz = precursors[0].IsolationTarget
+	if c.PrecursorMz == 0 {
+		c.PrecursorMz = precursors[0].Mz
+	}
+	c.CollisionEnergy = precursors[0].CollisionEnergy
+	product := m.Product.params(groups)
+	target, _ := product.Value("MS:1000827")
+	c.ProductMz, _ = strconv.ParseFloat(target, 64)
+
+	for i := range m.Arrays {
+		array := &m.Arrays[i]
+		length := m.DefaultArrayLength
+		if array.ArrayLength != 0 {
+			length = array.ArrayLength
+		}
+		arrayParams := array.params(groups)
+		values := array.decode(arrayParams, length)
+		if p, err := arrayParams.Get("MS:1000595"); err == nil {
+			if p.UnitAccession == "UO:0000010" || p.Unit == "second" {
+				for j := range values {
+					values[j] /= 60
+				}
+			}
+			c.TimeArray = values
+		} else if _, err := arrayParams.Get("MS:1000515"); err == nil {
+			c.IntensityArray = values
+		}
+	}
+	return c
+}
+
+// Decodes scan information read from a file
+//
+// Parameters:
+//   groups: The referenceableParamGroups of the file
+//   c: The channel to send the decoded Scan to
+func (m *mzMLSpectrum) scanInfo(groups mzMLParamGroups, c chan *Scan) {
+	s := new(Scan)
+	s.Id = mzMLScanNumber(m.Id, m.Index+1)
+	params := m.params(groups)
+	level, _ := params.Value("MS:1000511")
+	msLevel, _ := strconv.ParseUint(level, 10, 8)
+	s.MsLevel = uint8(msLevel)
+	if p, err := params.isA("MS:1000465"); err == nil {
+		if PsiMs.IsA(p.Accession, "MS:1000130") {
+			s.Polarity = 1
+		} else if PsiMs.IsA(p.Accession, "MS:1000129") {
+			s.Polarity = -1
+		}
+	}
+	if p, err := params.isA("MS:1000559"); err == nil {
+		s.SpectrumType = p.Accession
+	}
+	_, err := params.Get("MS:1000128")
+	s.Continuous = err == nil
+	params.remove("MS:1000511", "MS:1000465", "MS:1000525", "MS:1000559")
+	scanList := m.ScanList.params(groups)
+	scanList.remove("MS:1000795")
+	params = append(params, scanList...)
+
+	if len(m.ScanList.Scans) > 0 {
+		scan := &m.ScanList.Scans[0]
+		scanParams := scan.params(groups)
+		if p, err := scanParams.Get("MS:1000016"); err == nil {
+			s.RetentionTime, _ = strconv.ParseFloat(p.Value, 64)
+			if p.UnitAccession == "UO:0000010" || p.Unit == "second" {
+				s.RetentionTime /= 60
+			}
+		}
+		s.FilterLine, _ = scanParams.Value("MS:1000512")
+		for _, v := range mobilityTerms {
+			if p, err := scanParams.Get(v); err == nil {
+				s.Mobility, _ = strconv.ParseFloat(p.Value, 64)
+				s.MobilityUnit = mobilityUnit(p.Accession, p.UnitAccession,
+					p.Unit)
+				scanParams.remove(v)
+				break
+			}
+		}
+		scanParams.remove("MS:1000016", "MS:1000512")
+		s.ScanParams = scanParams
+		if len(scan.Windows) > 0 {
+			window := scan.Windows[0].params(groups)
+			lower, _ := window.Value("MS:1000501")
+			upper, _ := window.Value("MS:1000500")
+			s.MzRange[0], _ = strconv.ParseFloat(lower, 64)
+			s.MzRange[1], _ = strconv.ParseFloat(upper, 64)
+		}
+	}
+	s.Params = params
+
+	for i := range m.Precursors {
+		for _, p := range m.Precursors[i].precursors(groups) {
+			s.AddPrecursor(p)
+		}
+	}
+
+	for i := range m.Arrays {
+		array := &m.Arrays[i]
+		length := m.DefaultArrayLength
+		if array.ArrayLength != 0 {
+			length = array.ArrayLength
+		}
+		arrayParams := array.params(groups)
+		values := array.decode(arrayParams, length)
+		if _, err := arrayParams.Get("MS:1000514"); err == nil {
+			s.MzArray = values
+		} else if _, err := arrayParams.Get("MS:1000515"); err == nil {
+			s.IntensityArray = values
+		} else if p, err := arrayParams.isA("MS:1002893"); err == nil {
+			s.MobilityArray = values
+			s.MobilityUnit = mobilityUnit(p.Accession, p.UnitAccession, p.Unit)
+		} else if p, err := arrayParams.isA("MS:1000513"); err == nil {
+			a := DataArray{Accession: p.Accession, Name: p.Name, Unit: p.Unit,
+				Values: values}
+			// non-standard data arrays carry their name in the value
+			if PsiMs.Matches("MS:1000786", p.Accession, p.Name) &&
+				p.Value != "" {
+				a.Accession = ""
+				a.Name = p.Value
+			}
+			s.ExtraArrays = append(s.ExtraArrays, a)
+		}
+	}
+	if s.MzArray == nil {
+		s.MzArray = make([]float64, 0)
+	}
+	if s.IntensityArray == nil {
+		s.IntensityArray = make([]float64, 0)
+	}
+	c <- s
+}
+
+// Converts the precursor information read from a file to Precursors, one for
+// each selected ion.
+//
+// Parameters:
+//   groups: The referenceableParamGroups of the file
+//
+// Return value:
+//   []Precursor: The precursors
+func (m *mzMLPrecursor) precursors(groups mzMLParamGroups) []Precursor {
+	p := Precursor{ParentScan: mzMLScanNumber(m.SpectrumRef, 0)}
+	isolation := m.IsolationWindow.params(groups)
+	target, _ := isolation.Value("MS:1000827")
+	p.IsolationTarget, _ = strconv.ParseFloat(target, 64)
+	lower, _ := isolation.Value("MS:1000828")
+	p.IsolationLowerOffset, _ = strconv.ParseFloat(lower, 64)
+	upper, _ := isolation.Value("MS:1000829")
+	p.IsolationUpperOffset, _ = strconv.ParseFloat(upper, 64)
+	isolation.remove("MS:1000827", "MS:1000828", "MS:1000829")
+	activation := m.Activation.params(groups)
+	if method, err := activation.isA("MS:1000044"); err == nil {
+		p.ActivationMethod = activationMethod(method.Accession)
+		// methods which are not in the vocabulary are written as the value
+		// of the parent term
+		if cvAccession(method.Accession) == "MS:1000044" {
+			p.ActivationMethod = method.Value
+		}
+		activation.remove(method.Accession)
+	}
+	ce, _ := activation.Value("MS:1000045")
+	p.CollisionEnergy, _ = strconv.ParseFloat(ce, 64)
+	activation.remove("MS:1000045")
+	p.IsolationParams = isolation
+	p.ActivationParams = activation
+
+	ions := m.SelectedIons
+	if len(ions) == 0 {
+		p.Mz = p.IsolationTarget
+		return []Precursor{p}
+	}
+	var precursors []Precursor
+	for i := range ions {
+		ion := p.Clone()
+		params := ions[i].params(groups)
+		mz, _ := params.Value("MS:1000744")
+		ion.Mz, _ = strconv.ParseFloat(mz, 64)
+		charge, _ := params.Value("MS:1000041")
+		c, _ := strconv.ParseInt(charge, 10, 8)
+		ion.Charge = int8(c)
+		intensity, _ := params.Value("MS:1000042")
+		ion.Intensity, _ = strconv.ParseFloat(intensity, 64)
+		for _, v := range params {
+			if PsiMs.Matches("MS:1000633", v.Accession, v.Name) {
+				c, _ := strconv.ParseInt(v.Value, 10, 8)
+				ion.PossibleCharges = append(ion.PossibleCharges, int8(c))
+			}
+		}
+		params.remove("MS:1000744", "MS:1000041", "MS:1000042", "MS:1000633")
+		ion.SelectedIonParams = params
+		precursors = append(precursors, ion)
+	}
+	return precursors
+}
+
+// Decodes the values of a binary data array
+//
+// Parameters:
+//   params: The resolved parameters of the array
+//   length: The number of values in the array
+//
+// Return value:
+//   []float64: The decoded values
+func (a *mzMLBinaryArray) decode(params Params, length uint64) []float64 {
+	values := make([]float64, 0, length)
+	_, err := params.Get("MS:1000574")
+	compressed := err == nil
+	if _, err := params.Get("MS:1000521"); err == nil {
+		Float64FromBase64(&values, a.Binary, length, 32, compressed,
+			binary.LittleEndian)
+	} else if _, err := params.Get("MS:1000523"); err == nil {
+		Float64FromBase64(&values, a.Binary, length, 64, compressed,
+			binary.LittleEndian)
+	} else if _, err := params.Get("MS:1000519"); err == nil {
+		values = integersFromBase64(a.Binary, length, 32, compressed)
+	} else if _, err := params.Get("MS:1000522"); err == nil {
+		values = integersFromBase64(a.Binary, length, 64, compressed)
+	}
+	return values
+}
+
+// Converts a base64 string of little endian integers to an array of float64
+//
+// Parameters:
+//   src: The base64 encoded source string.
+//   count: The number of values present in the encoded string.
+//   precision: The number of bits in each value, either 32 or 64.
+//   compressed: Whether or not the data is compressed with zlib.
+//
+// Return value:
+//   []float64: The decoded values
+func integersFromBase64(src string, count uint64, precision uint8,
+	compressed bool) []float64 {
+	values := make([]float64, 0, count)
+	var reader io.Reader = base64.NewDecoder(base64.StdEncoding,
+		strings.NewReader(src))
+	if compressed {
+		reader, _ = zlib.NewReader(reader)
+	}
+	data, _ := ioutil.ReadAll(reader)
+	buf := bytes.NewReader(data)
+	for i := uint64(0); i < count; i++ {
+		if precision == 32 {
+			var value int32
+			if binary.Read(buf, binary.LittleEndian, &value) != nil {
+				break
+			}
+			values = append(values, float64(value))
+		} else {
+			var value int64
+			if binary.Read(buf, binary.LittleEndian, &value) != nil {
+				break
+			}
+			values = append(values, float64(value))
+		}
+	}
+	return values
+}
+
+// Collects the parameters of a group, including any referenced groups
+//
+// Parameters:
+//   groups: The referenceableParamGroups of the file
+//
+// Return value:
+//   Params: The parameters
+func (g *mzMLParamGroup) params(groups mzMLParamGroups) Params {
+	var params Params
+	for _, v := range g.Refs {
+		if ref, ok := groups[v.Ref]; ok && ref != g {
+			params = append(params, ref.params(groups)...)
+		}
+	}
+	for _, v := range g.CvParams {
+		params.Add(Param{CvLabel: v.CvRef, Accession: v.Accession,
+			Name: v.Name, Value: v.Value, UnitAccession: v.UnitAccession,
+			Unit: v.UnitName})
+	}
+	for _, v := range g.UserParams {
+		params.Add(Param{Name: v.Name, Value: v.Value,
+			UnitAccession: v.UnitAccession, Unit: v.UnitName})
+	}
+	return params
 }
 
+// Adds the parameters of an instrument component to the collection,
+// returning the name of the parameter which is a kind of the given term.
+//
+// Parameters:
+//   params: The parameters of the component
+//   parent: The accession of the term describing the component type
+//   current: The current name of the component
+//
+// Return value:
+//   string: The name of the component
+func (p *Params) addComponent(params Params, parent string,
+	current string) string {
+	if term, err := params.isA(parent); err == nil {
+		current = term.Name
+		// names which are not in the vocabulary are written as the value of
+		// the parent term
+		if cvAccession(term.Accession) == parent && term.Value != "" {
+			current = term.Value
+		}
+		params.remove(term.Accession)
+	}
+	*p = append(*p, params...)
+	return current
+}
+
+// Finds the first parameter which is a kind of the given term.
+//
+// Parameters:
+//   parent: The accession of the term
+//
+// Return values:
+//   *Param: A pointer to the parameter, or nil if not found
+//   error: An error if no parameter was found
+func (p *Params) isA(parent string) (*Param, error) {
+	for i := range *p {
+		if (*p)[i].Accession != "" && PsiMs.IsA((*p)[i].Accession, parent) {
+			return &(*p)[i], nil
+		}
+	}
+	return nil, errors.New(fmt.Sprintf("Param '%s' Not Found", parent))
+}
+
+// Removes any parameters which refer to, or are a kind of, the given terms.
+//
+// Parameters:
+//   keys: The accessions of the terms to remove
+func (p *Params) remove(keys ...string) {
+	params := (*p)[:0]
+outer:
+	for _, v := range *p {
+		for _, k := range keys {
+			if PsiMs.Matches(k, v.Accession, v.Name) ||
+				(v.Accession != "" && PsiMs.IsA(v.Accession, k)) {
+				continue outer
+			}
+		}
+		params = append(params, v)
+	}
+	*p = params
+}
+
+// Extracts the scan number from an mzML native id such as
+// "controllerType=0 controllerNumber=1 scan=42".
+//
+// Parameters:
+//   id: The native id
+//   fallback: The value to return if no scan number is found
+//
+// Return value:
+//   uint64: The scan number
+func mzMLScanNumber(id string, fallback uint64) uint64 {
+	for _, key := range []string{"scan=", "scanId=", "spectrum=", "index="} {
+		for _, field := range strings.Fields(id) {
+			if strings.HasPrefix(field, key) {
+				n, err := strconv.ParseUint(field[len(key):], 10, 64)
+				if err == nil {
+					if key == "index=" {
+						n++
+					}
+					return n
+				}
+			}
+		}
+	}
+	if n, err := strconv.ParseUint(id, 10, 64); err == nil {
+		return n
+	}
+	return fallback
+}
+
+// Writes the data to disk in MzML format
+//
+// Parameters:
+//   filename: The name of the file to be written to
+//
+// Return value:
+//   error: Indicates whether or not an error occurred while writing the file
 func (r *RawData) WriteMzMl(filename string) error {
-	return errors.New("Writing this file type has not yet been implemented")
+	outFile, err := os.OpenFile(filename,
+		os.O_WRONLY|os.O_CREATE|os.O_TRUNC,
+		0770)
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(outFile)
+	defer outFile.Close()
+	err = r.EncodeMzMl(out)
+	if err != nil {
+		return err
+	}
+	out.Flush()
+	return nil
 }
 
+// Encodes the data in MzML format, including any Chromatograms
+//
+// Parameters:
+//   writer: The writer to write the data to
+//
+// Return value:
+//   error: Indicates whether or not an error occurred while writing the data
 func (r *RawData) EncodeMzMl(writer io.Writer) error {
-	return errors.New("Writing this file type has not yet been implemented")
+	var sourceFileName string
+	var sourceFilePath string
+	pathIndex := strings.LastIndex(r.Filename, "/")
+	if pathIndex >= 0 {
+		sourceFileName = r.Filename[pathIndex+1:]
+		sourceFilePath = r.Filename[:pathIndex]
+	} else {
+		sourceFileName = r.Filename
+	}
+	model := fmt.Sprintf(`
+      <cvParam cvRef="MS" accession="MS:1000031" name="instrument model" value="%s"/>`,
+		escape(r.Instrument.Model))
+	if term, err := PsiMs.Find(r.Instrument.Model); err == nil &&
+		r.Instrument.Model != "" && PsiMs.IsA(term.Id, "MS:1000031") {
+		model = mzMLTerm(r.Instrument.Model, "MS:1000031", "      ")
+	}
+	processing := `
+        <cvParam cvRef="MS" accession="MS:1000544" name="Conversion to mzML" value=""/>`
+	if len(r.Scans) > 0 && r.Scans[0].DeIsotoped {
+		processing += `
+        <cvParam cvRef="MS" accession="MS:1000033" name="deisotoping" value=""/>`
+	}
+	_, err := fmt.Fprintf(writer, `<?xml version="1.0" encoding="UTF-8"?>
+<mzML xmlns="http://psi.hupo.org/ms/mzml" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" version="1.1.0">
+  <cvList count="2">
+    <cv id="MS" fullName="Proteomics Standards Initiative Mass Spectrometry Ontology" URI="https://raw.githubusercontent.com/HUPO-PSI/psi-ms-CV/master/psi-ms.obo"/>
+    <cv id="UO" fullName="Unit Ontology" URI="http://ontologies.berkeleybop.org/uo.obo"/>
+  </cvList>
+  <fileDescription>
+    <fileContent>%s
+    </fileContent>
+    <sourceFileList count="1">
+      <sourceFile id="SF1" name="%s" location="file://%s"/>
+    </sourceFileList>
+  </fileDescription>
+  <softwareList count="1">
+    <software id="gomzlib" version="%s">
+      <cvParam cvRef="MS" accession="MS:1000799" name="custom unreleased software tool" value="gomzlib"/>
+    </software>
+  </softwareList>
+  <instrumentConfigurationList count="1">
+    <instrumentConfiguration id="IC1">%s%s
+      <componentList count="3">
+        <source order="1">%s
+        </source>
+        <analyzer order="2">%s
+        </analyzer>
+        <detector order="3">%s
+        </detector>
+      </componentList>
+    </instrumentConfiguration>
+  </instrumentConfigurationList>
+  <dataProcessingList count="1">
+    <dataProcessing id="gomzlib_processing">
+      <processingMethod order="1" softwareRef="gomzlib">%s
+      </processingMethod>
+    </dataProcessing>
+  </dataProcessingList>
+  <run id="run1" defaultInstrumentConfigurationRef="IC1">
+    <spectrumList count="%d" defaultDataProcessingRef="gomzlib_processing">`,
+		r.Params.mzML("      "), escape(sourceFileName),
+		escape(sourceFilePath), Version, model,
+		r.Instrument.Params.mzML("      "),
+		mzMLTerm(r.Instrument.Ionization, "MS:1000008", "          ")+
+			r.Instrument.SourceParams.mzML("          "),
+		mzMLTerm(r.Instrument.MassAnalyzer, "MS:1000443", "          ")+
+			r.Instrument.AnalyzerParams.mzML("          "),
+		mzMLTerm(r.Instrument.Detector, "MS:1000026", "          ")+
+			r.Instrument.DetectorParams.mzML("          "),
+		processing, len(r.Scans))
+	if err != nil {
+		return err
+	}
+	for i := range r.Scans {
+		if err = r.Scans[i].encodeMzMl(writer, i); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(writer, `
+    </spectrumList>`)
+	if err != nil {
+		return err
+	}
+	if len(r.Chromatograms) > 0 {
+		_, err = fmt.Fprintf(writer, `
+    <chromatogramList count="%d" defaultDataProcessingRef="gomzlib_processing">`,
+			len(r.Chromatograms))
+		if err != nil {
+			return err
+		}
+		for i := range r.Chromatograms {
+			if err = r.Chromatograms[i].encodeMzMl(writer, i); err != nil {
+				return err
+			}
+		}
+		_, err = fmt.Fprintf(writer, `
+    </chromatogramList>`)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(writer, `
+  </run>
+</mzML>
+`)
+	return err
+}
+
+// Writes a spectrum element in MzML format
+//
+// Parameters:
+//   writer: The writer to write the element to
+//   index: The index of the spectrum in the spectrumList
+//
+// Return value:
+//   error: Indicates whether or not an error occurred while writing
+func (s *Scan) encodeMzMl(writer io.Writer, index int) error {
+	spectrumType := `
+          <cvParam cvRef="MS" accession="MS:1000580" name="MSn spectrum" value=""/>`
+	if s.SpectrumType != "" {
+		spectrumType = mzMLTerm(s.SpectrumType, "MS:1000559", "          ")
+	} else if s.MsLevel == 1 {
+		spectrumType = `
+          <cvParam cvRef="MS" accession="MS:1000579" name="MS1 spectrum" value=""/>`
+	}
+	polarity := ""
+	if s.Polarity > 0 {
+		polarity = `
+          <cvParam cvRef="MS" accession="MS:1000130" name="positive scan" value=""/>`
+	} else if s.Polarity < 0 {
+		polarity = `
+          <cvParam cvRef="MS" accession="MS:1000129" name="negative scan" value=""/>`
+	}
+	representation := `
+          <cvParam cvRef="MS" accession="MS:1000127" name="centroid spectrum" value=""/>`
+	if s.Continuous {
+		representation = `
+          <cvParam cvRef="MS" accession="MS:1000128" name="profile spectrum" value=""/>`
+	}
+	scan := ""
+	if s.FilterLine != "" {
+		scan += fmt.Sprintf(`
+              <cvParam cvRef="MS" accession="MS:1000512" name="filter string" value="%s"/>`,
+			escape(s.FilterLine))
+	}
+	if s.MobilityUnit != "" && len(s.MobilityArray) == 0 {
+		scan += mzMLMobility(s.Mobility, s.MobilityUnit)
+	}
+	scan += s.ScanParams.mzML("              ")
+	window := ""
+	if s.MzRange[0] != 0 || s.MzRange[1] != 0 {
+		window = fmt.Sprintf(`
+              <scanWindowList count="1">
+                <scanWindow>
+                  <cvParam cvRef="MS" accession="MS:1000501" name="scan window lower limit" value="%f" unitCvRef="MS" unitAccession="MS:1000040" unitName="m/z"/>
+                  <cvParam cvRef="MS" accession="MS:1000500" name="scan window upper limit" value="%f" unitCvRef="MS" unitAccession="MS:1000040" unitName="m/z"/>
+                </scanWindow>
+              </scanWindowList>`, s.MzRange[0], s.MzRange[1])
+	}
+	_, err := fmt.Fprintf(writer, `
+      <spectrum index="%d" id="scan=%d" defaultArrayLength="%d">
+          <cvParam cvRef="MS" accession="MS:1000511" name="ms level" value="%d"/>%s%s%s%s
+          <scanList count="1">
+            <cvParam cvRef="MS" accession="MS:1000795" name="no combination" value=""/>
+            <scan>
+              <cvParam cvRef="MS" accession="MS:1000016" name="scan start time" value="%f" unitCvRef="UO" unitAccession="UO:0000031" unitName="minute"/>%s%s
+            </scan>
+          </scanList>`, index, s.Id, len(s.MzArray), s.MsLevel, spectrumType,
+		polarity, representation, s.Params.mzML("          "),
+		s.RetentionTime, scan, window)
+	if err != nil {
+		return err
+	}
+	if precursors := s.precursors(); len(precursors) > 0 {
+		_, err = fmt.Fprintf(writer, `
+          <precursorList count="%d">`, len(precursors))
+		if err != nil {
+			return err
+		}
+		for i := range precursors {
+			_, err = fmt.Fprintf(writer, `
+            <precursor%s>%s%s%s
+            </precursor>`, mzMLSpectrumRef(precursors[i].ParentScan),
+				precursors[i].mzMLIsolationWindow(),
+				precursors[i].mzMLSelectedIon(),
+				precursors[i].mzMLActivation())
+			if err != nil {
+				return err
+			}
+		}
+		_, err = fmt.Fprintf(writer, `
+          </precursorList>`)
+		if err != nil {
+			return err
+		}
+	}
+	arrays := mzMLBinaryDataArray("MS:1000514", "m/z array",
+		`unitCvRef="MS" unitAccession="MS:1000040" unitName="m/z"`, s.MzArray)
+	arrays += mzMLBinaryDataArray("MS:1000515", "intensity array",
+		`unitCvRef="MS" unitAccession="MS:1000131" unitName="number of detector counts"`,
+		s.IntensityArray)
+	count := 2
+	if len(s.MobilityArray) > 0 {
+		accession, name, unit := mzMLMobilityArray(s.MobilityUnit)
+		arrays += mzMLBinaryDataArray(accession, name, unit, s.MobilityArray)
+		count++
+	}
+	for _, a := range s.ExtraArrays {
+		if a.Accession != "" {
+			arrays += mzMLBinaryDataArray(a.Accession, a.Name, "", a.Values)
+		} else {
+			arrays += mzMLBinaryDataArray("MS:1000786", "non-standard data array",
+				fmt.Sprintf(`value="%s"`, escape(a.Name)), a.Values)
+		}
+		count++
+	}
+	_, err = fmt.Fprintf(writer, `
+          <binaryDataArrayList count="%d">%s
+          </binaryDataArrayList>
+      </spectrum>`, count, arrays)
+	return err
+}
+
+// Writes a chromatogram element in MzML format
+//
+// Parameters:
+//   writer: The writer to write the element to
+//   index: The index of the chromatogram in the chromatogramList
+//
+// Return value:
+//   error: Indicates whether or not an error occurred while writing
+func (c *Chromatogram) encodeMzMl(writer io.Writer, index int) error {
+	id := c.Id
+	if id == "" {
+		id = fmt.Sprintf("chromatogram=%d", index+1)
+	}
+	params := ""
+	if c.Type != "" {
+		params += mzMLTerm(c.Type, "MS:1000626", "          ")
+	}
+	if c.MsLevel != 0 {
+		params += fmt.Sprintf(`
+          <cvParam cvRef="MS" accession="MS:1000511" name="ms level" value="%d"/>`,
+			c.MsLevel)
+	}
+	if c.Polarity > 0 {
+		params += `
+          <cvParam cvRef="MS" accession="MS:1000130" name="positive scan" value=""/>`
+	} else if c.Polarity < 0 {
+		params += `
+          <cvParam cvRef="MS" accession="MS:1000129" name="negative scan" value=""/>`
+	}
+	if c.MzRange[0] != 0 || c.MzRange[1] != 0 {
+		params += fmt.Sprintf(`
+          <cvParam cvRef="MS" accession="MS:1000501" name="scan window lower limit" value="%f" unitCvRef="MS" unitAccession="MS:1000040" unitName="m/z"/>
+          <cvParam cvRef="MS" accession="MS:1000500" name="scan window upper limit" value="%f" unitCvRef="MS" unitAccession="MS:1000040" unitName="m/z"/>`,
+			c.MzRange[0], c.MzRange[1])
+	}
+	params += c.Params.mzML("          ")
+	if c.PrecursorMz != 0 {
+		p := Precursor{IsolationTarget: c.PrecursorMz,
+			CollisionEnergy: c.CollisionEnergy}
+		params += fmt.Sprintf(`
+          <precursor>%s%s
+          </precursor>`, p.mzMLIsolationWindow(), p.mzMLActivation())
+	}
+	if c.ProductMz != 0 {
+		params += fmt.Sprintf(`
+          <product>
+            <isolationWindow>
+              <cvParam cvRef="MS" accession="MS:1000827" name="isolation window target m/z" value="%f" unitCvRef="MS" unitAccession="MS:1000040" unitName="m/z"/>
+            </isolationWindow>
+          </product>`, c.ProductMz)
+	}
+	arrays := mzMLBinaryDataArray("MS:1000595", "time array",
+		`unitCvRef="UO" unitAccession="UO:0000031" unitName="minute"`,
+		c.TimeArray)
+	arrays += mzMLBinaryDataArray("MS:1000515", "intensity array",
+		`unitCvRef="MS" unitAccession="MS:1000131" unitName="number of detector counts"`,
+		c.IntensityArray)
+	_, err := fmt.Fprintf(writer, `
+      <chromatogram index="%d" id="%s" defaultArrayLength="%d">%s
+          <binaryDataArrayList count="2">%s
+          </binaryDataArrayList>
+      </chromatogram>`, index, escape(id), len(c.TimeArray), params, arrays)
+	return err
+}
+
+// Renders the isolationWindow element of a precursor in MzML format
+func (p *Precursor) mzMLIsolationWindow() string {
+	target := p.IsolationTarget
+	if target == 0 {
+		target = p.Mz
+	}
+	window := fmt.Sprintf(`
+              <cvParam cvRef="MS" accession="MS:1000827" name="isolation window target m/z" value="%f" unitCvRef="MS" unitAccession="MS:1000040" unitName="m/z"/>`,
+		target)
+	if p.IsolationLowerOffset != 0 || p.IsolationUpperOffset != 0 {
+		window += fmt.Sprintf(`
+              <cvParam cvRef="MS" accession="MS:1000828" name="isolation window lower offset" value="%f" unitCvRef="MS" unitAccession="MS:1000040" unitName="m/z"/>
+              <cvParam cvRef="MS" accession="MS:1000829" name="isolation window upper offset" value="%f" unitCvRef="MS" unitAccession="MS:1000040" unitName="m/z"/>`,
+			p.IsolationLowerOffset, p.IsolationUpperOffset)
+	}
+	window += p.IsolationParams.mzML("              ")
+	return fmt.Sprintf(`
+              <isolationWindow>%s
+              </isolationWindow>`, window)
+}
+
+// Renders the selectedIonList element of a precursor in MzML format
+func (p *Precursor) mzMLSelectedIon() string {
+	ion := fmt.Sprintf(`
+                  <cvParam cvRef="MS" accession="MS:1000744" name="selected ion m/z" value="%f" unitCvRef="MS" unitAccession="MS:1000040" unitName="m/z"/>`,
+		p.Mz)
+	if p.Charge != 0 {
+		ion += fmt.Sprintf(`
+                  <cvParam cvRef="MS" accession="MS:1000041" name="charge state" value="%d"/>`,
+			p.Charge)
+	}
+	for _, v := range p.PossibleCharges {
+		ion += fmt.Sprintf(`
+                  <cvParam cvRef="MS" accession="MS:1000633" name="possible charge state" value="%d"/>`,
+			v)
+	}
+	if p.Intensity != 0 {
+		ion += fmt.Sprintf(`
+                  <cvParam cvRef="MS" accession="MS:1000042" name="peak intensity" value="%f" unitCvRef="MS" unitAccession="MS:1000131" unitName="number of detector counts"/>`,
+			p.Intensity)
+	}
+	ion += p.SelectedIonParams.mzML("                  ")
+	return fmt.Sprintf(`
+              <selectedIonList count="1">
+                <selectedIon>%s
+                </selectedIon>
+              </selectedIonList>`, ion)
+}
+
+// Renders the activation element of a precursor in MzML format
+func (p *Precursor) mzMLActivation() string {
+	method := p.ActivationMethod
+	if accession, ok := activationAccessions[method]; ok {
+		method = accession
+	}
+	// the activation element requires a dissociation method, so an unknown
+	// method is written as the parent term
+	activation := mzMLTerm(method, "MS:1000044", "                ")
+	if p.CollisionEnergy != 0 {
+		activation += fmt.Sprintf(`
+                <cvParam cvRef="MS" accession="MS:1000045" name="collision energy" value="%f" unitCvRef="UO" unitAccession="UO:0000266" unitName="electronvolt"/>`,
+			p.CollisionEnergy)
+	}
+	activation += p.ActivationParams.mzML("                ")
+	return fmt.Sprintf(`
+              <activation>%s
+              </activation>`, activation)
+}
+
+// Renders a cvParam for a term in MzML format. Terms which are not a kind of
+// the parent term in the PsiMs vocabulary are written as the value of the
+// parent term.
+//
+// Parameters:
+//   key: The name or accession of the term
+//   parent: The accession of the parent term
+//   indent: The indentation to prefix the element with
+//
+// Return value:
+//   string: The rendered element, preceded by a newline
+func mzMLTerm(key string, parent string, indent string) string {
+	term, err := PsiMs.Term(key)
+	if err != nil {
+		term, err = PsiMs.Find(key)
+	}
+	if err == nil && key != "" && PsiMs.IsA(term.Id, parent) {
+		return fmt.Sprintf(`
+%s<cvParam cvRef="%s" accession="%s" name="%s" value=""/>`, indent,
+			cvRef(term.Id), term.Id, escape(term.Name))
+	}
+	name := ""
+	if term, err := PsiMs.Term(parent); err == nil {
+		name = term.Name
+	}
+	return fmt.Sprintf(`
+%s<cvParam cvRef="%s" accession="%s" name="%s" value="%s"/>`, indent,
+		cvRef(parent), parent, escape(name), escape(key))
+}
+
+// Renders the cvParam for a scan level ion mobility value in MzML format
+//
+// Parameters:
+//   mobility: The mobility value
+//   unit: The Scan.MobilityUnit of the value
+//
+// Return value:
+//   string: The rendered element, preceded by a newline
+func mzMLMobility(mobility float64, unit string) string {
+	accession, name := "MS:1002815", "inverse reduced ion mobility"
+	unitAttributes := `unitCvRef="MS" unitAccession="MS:1002814" unitName="volt-second per square centimeter"`
+	switch unit {
+	case MobilityMillisecond:
+		accession, name = "MS:1002476", "ion mobility drift time"
+		unitAttributes = `unitCvRef="UO" unitAccession="UO:0000028" unitName="millisecond"`
+	case MobilityVolt:
+		accession, name = "MS:1001581", "FAIMS compensation voltage"
+		unitAttributes = `unitCvRef="UO" unitAccession="UO:0000218" unitName="volt"`
+	}
+	return fmt.Sprintf(`
+              <cvParam cvRef="MS" accession="%s" name="%s" value="%f" %s/>`,
+		accession, name, mobility, unitAttributes)
+}
+
+// Determines the array type for a MobilityArray with the given
+// Scan.MobilityUnit
+//
+// Return values:
+//   string: The accession of the array type
+//   string: The name of the array type
+//   string: The unit attributes of the array type
+func mzMLMobilityArray(unit string) (string, string, string) {
+	switch unit {
+	case MobilityMillisecond:
+		return "MS:1002477", "mean ion mobility drift time array",
+			`unitCvRef="UO" unitAccession="UO:0000028" unitName="millisecond"`
+	case MobilityVsPerCm2:
+		return "MS:1003006", "mean inverse reduced ion mobility array",
+			`unitCvRef="MS" unitAccession="MS:1002814" unitName="volt-second per square centimeter"`
+	}
+	return "MS:1002816", "mean ion mobility array", ""
+}
+
+// Renders a binaryDataArray element in MzML format, using uncompressed 64-bit
+// floats
+//
+// Parameters:
+//   accession: The accession of the array type
+//   name: The name of the array type
+//   attributes: Any additional attributes for the array type cvParam
+//   values: The values of the array
+//
+// Return value:
+//   string: The rendered element, preceded by a newline
+func mzMLBinaryDataArray(accession string, name string, attributes string,
+	values []float64) string {
+	if attributes != "" && !strings.HasPrefix(attributes, "value=") {
+		attributes = `value="" ` + attributes
+	} else if attributes == "" {
+		attributes = `value=""`
+	}
+	encoded := Base64FromFloat64(&values, 64, binary.LittleEndian)
+	return fmt.Sprintf(`
+            <binaryDataArray encodedLength="%d">
+              <cvParam cvRef="MS" accession="MS:1000523" name="64-bit float" value=""/>
+              <cvParam cvRef="MS" accession="MS:1000576" name="no compression" value=""/>
+              <cvParam cvRef="%s" accession="%s" name="%s" %s/>
+              <binary>%s</binary>
+            </binaryDataArray>`, len(encoded), cvRef(accession), accession,
+		escape(name), attributes, encoded)
+}
+
+// Renders a spectrumRef attribute for a parent scan, if any
+func mzMLSpectrumRef(parentScan uint64) string {
+	if parentScan == 0 {
+		return ""
+	}
+	return fmt.Sprintf(` spectrumRef="scan=%d"`, parentScan)
+}
+
+// Returns the cvRef for an accession, e.g. "MS" for "MS:1000514"
+func cvRef(accession string) string {
+	accession = cvAccession(accession)
+	if i := strings.Index(accession, ":"); i >= 0 {
+		return accession[:i]
+	}
+	return "MS"
 }
@@ -22,6 +22,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 )
 
 type mzxml struct {
@@ -32,17 +33,26 @@ type mzxml struct {
 		} `xml:"parentFile"`
 		Instrument msinstrument `xml:"msInstrument"`
 		Processing struct {
-			Centroided int8 `xml:"centroided,attr"`
+			Centroided string      `xml:"centroided,attr"`
+			DeIsotoped string      `xml:"deisotoped,attr"`
+			Operations []nameValue `xml:"processingOperation"`
 		} `xml:"dataProcessing"`
 		Scans []mzxmlscan `xml:"scan"`
 	} `xml:"msRun"`
 }
 
 type mzxmlscan struct {
-	Peaks             peaks       `xml:"peaks"`
+	Peaks             []peaks     `xml:"peaks"`
 	MsLevel           uint8       `xml:"msLevel,attr"`
 	Id                uint64      `xml:"num,attr"`
 	Scans             []mzxmlscan `xml:"scan"`
+	NameValues        []nameValue `xml:"nameValue"`
+	ScanType          string      `xml:"scanType,attr"`
+	FilterLine        string      `xml:"filterLine,attr"`
+	Centroided        string      `xml:"centroided,attr"`
+	DeIsotoped        string      `xml:"deisotoped,attr"`
+	StartMz           float64     `xml:"startMz,attr"`
+	EndMz             float64     `xml:"endMz,attr"`
 	LowMz             float64     `xml:"lowMz,attr"`
 	HighMz            float64     `xml:"highMz,attr"`
 	BasePeakMz        float64     `xml:"basePeakMz,attr"`
@@ -52,9 +62,14 @@ type mzxmlscan struct {
 	Polarity          string      `xml:"polarity,attr"`
 	RetentionTime     string      `xml:"retentionTime,attr"`
 	CollisionEnergy   float64     `xml:"collisionEnergy,attr"`
-	Precursor         struct {
-		Intensity float64 `xml:"precursorIntensity,attr"`
-		Mz        float64 `xml:",chardata"`
+	Precursors        []struct {
+		ParentScan       uint64  `xml:"precursorScanNum,attr"`
+		Intensity        float64 `xml:"precursorIntensity,attr"`
+		Charge           int8    `xml:"precursorCharge,attr"`
+		PossibleCharges  string  `xml:"possibleCharges,attr"`
+		WindowWideness   float64 `xml:"windowWideness,attr"`
+		ActivationMethod string  `xml:"activationMethod,attr"`
+		Mz               float64 `xml:",chardata"`
 	} `xml:"precursorMz"`
 }
 
@@ -63,6 +78,7 @@ type peaks struct {
 	Precision       uint8  `xml:"precision,attr"`
 	ByteOrder       string `xml:"byteOrder,attr"`
 	PairOrder       string `xml:"pairOrder,attr"`
+	ContentType     string `xml:"contentType,attr"`
 	CompressionType string `xml:"compressionType,attr"`
 }
 
@@ -71,11 +87,26 @@ type msinstrument struct {
 		Name string `xml:"value,attr"`
 	} `xml:"msManufacturer"`
 	Model struct {
-		Name string `xml:value,attr"`
+		Name string `xml:"value,attr"`
 	} `xml:"msModel"`
+	Ionization struct {
+		Name string `xml:"value,attr"`
+	} `xml:"msIonisation"`
 	MassAnalyzer struct {
 		Name string `xml:"value,attr"`
 	} `xml:"msMassAnalyzer"`
+	Detector struct {
+		Name string `xml:"value,attr"`
+	} `xml:"msDetector"`
+	Resolution struct {
+		Value string `xml:"value,attr"`
+	} `xml:"msResolution"`
+	NameValues []nameValue `xml:"nameValue"`
+}
+
+type nameValue struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
 }
 
 // Reads data from an MzXML file
@@ -119,24 +150,34 @@ func (r *RawData) DecodeMzXml(reader io.Reader) error {
 	r.Instrument.Model = mz.Run.Instrument.Model.Name
 	r.Instrument.Manufacturer = mz.Run.Instrument.Manufacturer.Name
 	r.Instrument.MassAnalyzer = mz.Run.Instrument.MassAnalyzer.Name
+	r.Instrument.Ionization = mz.Run.Instrument.Ionization.Name
+	r.Instrument.Detector = mz.Run.Instrument.Detector.Name
+	r.Instrument.Resolution, _ =
+		strconv.ParseFloat(mz.Run.Instrument.Resolution.Value, 64)
+	r.Instrument.Params = nil
+	r.Instrument.Params.addMzXml(mz.Run.Instrument.NameValues)
+	r.Params = nil
+	r.Params.addMzXml(mz.Run.Processing.Operations)
 	r.ScanCount = mz.Run.ScanCount
 	// copy scan information
+	centroided := mzxmlBool(mz.Run.Processing.Centroided, false)
+	deIsotoped := mzxmlBool(mz.Run.Processing.DeIsotoped, false)
 	var chans []chan *Scan
 	for i := 0; i < len(mz.Run.Scans); i++ {
 		c := make(chan *Scan)
-		go mz.Run.Scans[i].scanInfo(0, c)
+		go mz.Run.Scans[i].scanInfo(0, centroided, deIsotoped, c)
 		chans = append(chans, c)
 		if len(mz.Run.Scans[i].Scans) > 0 {
 			for j := 0; j < len(mz.Run.Scans[i].Scans); j++ {
 				c = make(chan *Scan)
-				go mz.Run.Scans[i].Scans[j].scanInfo(mz.Run.Scans[i].Id, c)
+				go mz.Run.Scans[i].Scans[j].scanInfo(mz.Run.Scans[i].Id,
+					centroided, deIsotoped, c)
 				chans = append(chans, c)
 			}
 		}
 	}
 	for _, c := range chans {
 		s := <-c
-		s.Continuous = mz.Run.Processing.Centroided == 0
 		r.Scans = append(r.Scans, *s)
 	}
 	return nil
@@ -160,13 +201,16 @@ func (r *RawData) EncodeMzXml(writer io.Writer) error {
 // Decodes scan information read from a file
 //
 // Parameters:
-//   s: A pointer to the Scan struct to save the decoded data to
 //   parentScan: The Id of the parent scan, or 0 if none
-func (m *mzxmlscan) scanInfo(parentScan uint64, c chan *Scan) {
+//   centroided: The run level centroided value, used when the scan does not
+//     specify one
+//   deIsotoped: The run level deisotoped value, used when the scan does not
+//     specify one
+//   c: The channel to send the decoded Scan to
+func (m *mzxmlscan) scanInfo(parentScan uint64, centroided bool,
+	deIsotoped bool, c chan *Scan) {
 	s := new(Scan)
-	rt := m.RetentionTime
-	s.RetentionTime, _ = strconv.ParseFloat(rt[2:len(rt)-1], 64)
-	s.RetentionTime /= 60
+	s.RetentionTime = mzxmlDuration(m.RetentionTime)
 	if m.Polarity == "-" {
 		s.Polarity = -1
 	} else if m.Polarity == "+" {
@@ -176,25 +220,156 @@ func (m *mzxmlscan) scanInfo(parentScan uint64, c chan *Scan) {
 	}
 	s.MsLevel = m.MsLevel
 	s.Id = m.Id
-	s.MzRange[0] = m.LowMz
-	s.MzRange[1] = m.HighMz
+	s.ScanType = m.ScanType
+	s.FilterLine = m.FilterLine
+	if m.StartMz != 0 || m.EndMz != 0 {
+		s.MzRange[0] = m.StartMz
+		s.MzRange[1] = m.EndMz
+	} else {
+		s.MzRange[0] = m.LowMz
+		s.MzRange[1] = m.HighMz
+	}
 	s.ParentScan = parentScan
-	s.PrecursorMz = m.Precursor.Mz
-	s.PrecursorIntensity = m.Precursor.Intensity
 	s.CollisionEnergy = m.CollisionEnergy
+	for _, v := range m.Precursors {
+		p := Precursor{
+			ParentScan:           v.ParentScan,
+			Mz:                   v.Mz,
+			Intensity:            v.Intensity,
+			Charge:               v.Charge,
+			IsolationTarget:      v.Mz,
+			IsolationLowerOffset: v.WindowWideness / 2,
+			IsolationUpperOffset: v.WindowWideness / 2,
+			ActivationMethod:     activationMethod(v.ActivationMethod),
+			CollisionEnergy:      m.CollisionEnergy,
+		}
+		if p.ParentScan == 0 {
+			p.ParentScan = parentScan
+		}
+		for _, c := range strings.Split(v.PossibleCharges, ",") {
+			if charge, err := strconv.ParseInt(strings.TrimSpace(c), 10,
+				8); err == nil {
+				p.PossibleCharges = append(p.PossibleCharges, int8(charge))
+			}
+		}
+		s.AddPrecursor(p)
+	}
+	s.Params.addMzXml(m.NameValues)
+	s.Continuous = !mzxmlBool(m.Centroided, centroided)
+	s.DeIsotoped = mzxmlBool(m.DeIsotoped, deIsotoped)
 
 	// now decode the peak data
 	s.MzArray = make([]float64, 0, m.PeakCount)
 	s.IntensityArray = make([]float64, 0, m.PeakCount)
-	values := make([]float64, 0, m.PeakCount*2)
-	// mzxml is always bigEndian per the spec
-	_ = Float64FromBase64(&values, m.Peaks.PeakList, m.PeakCount*2,
-		m.Peaks.Precision,
-		m.Peaks.CompressionType == "zlib", binary.BigEndian)
-	n := len(values)
-	for i := 0; i < n; i += 2 {
-		s.MzArray = append(s.MzArray, values[i])
-		s.IntensityArray = append(s.IntensityArray, values[i+1])
+	for _, p := range m.Peaks {
+		p.decode(s, m.PeakCount)
 	}
 	c <- s
 }
+
+// Decodes the values in a peaks element into the appropriate arrays of a Scan.
+// Content types other than m/z and intensity are added to the ExtraArrays.
+//
+// Parameters:
+//   s: A pointer to the Scan to store the values in
+//   peakCount: The number of peaks in the scan
+func (p *peaks) decode(s *Scan, peakCount uint64) {
+	contentType := p.ContentType
+	if contentType == "" {
+		contentType = p.PairOrder
+	}
+	precision := p.Precision
+	if precision == 0 {
+		precision = 32 // the default per the spec
+	}
+	// mzxml is always bigEndian per the spec
+	compressed := p.CompressionType == "zlib"
+	switch contentType {
+	case "", "m/z-int", "int-m/z":
+		values := make([]float64, 0, peakCount*2)
+		_ = Float64FromBase64(&values, p.PeakList, peakCount*2, precision,
+			compressed, binary.BigEndian)
+		mz, intensity := 0, 1
+		if contentType == "int-m/z" {
+			mz, intensity = 1, 0
+		}
+		for i, n := 0, len(values); i+1 < n; i += 2 {
+			s.MzArray = append(s.MzArray, values[i+mz])
+			s.IntensityArray = append(s.IntensityArray, values[i+intensity])
+		}
+	case "m/z":
+		_ = Float64FromBase64(&s.MzArray, p.PeakList, peakCount, precision,
+			compressed, binary.BigEndian)
+	case "intensity":
+		_ = Float64FromBase64(&s.IntensityArray, p.PeakList, peakCount,
+			precision, compressed, binary.BigEndian)
+	default:
+		key := contentType
+		if contentType == "S/N" {
+			key = SignalToNoiseArray
+		} else if contentType == "charge" {
+			key = ChargeArray
+		}
+		a := NewDataArray(key, nil)
+		_ = Float64FromBase64(&a.Values, p.PeakList, peakCount, precision,
+			compressed, binary.BigEndian)
+		s.SetExtraArray(a)
+	}
+}
+
+// Adds mzXML nameValue elements to a parameter collection as user parameters
+//
+// Parameters:
+//   values: The nameValue elements to add
+func (p *Params) addMzXml(values []nameValue) {
+	for _, v := range values {
+		p.Add(Param{Name: v.Name, Value: v.Value})
+	}
+}
+
+// Parses an xs:boolean attribute, which may be "1", "0", "true" or "false"
+//
+// Parameters:
+//   value: The value of the attribute
+//   fallback: The value to return if the attribute is empty or invalid
+//
+// Return value:
+//   bool: The parsed value
+func mzxmlBool(value string, fallback bool) bool {
+	if b, err := strconv.ParseBool(strings.TrimSpace(value)); err == nil {
+		return b
+	}
+	return fallback
+}
+
+// Converts an xs:duration value such as "PT12.5S" or "PT1M30S" to minutes
+//
+// Parameters:
+//   duration: The duration string to convert
+//
+// Return value:
+//   float64: The duration in minutes, or 0 if it could not be parsed
+func mzxmlDuration(duration string) float64 {
+	minutes := 0.0
+	if !strings.HasPrefix(duration, "PT") {
+		return minutes
+	}
+	value := duration[2:]
+	for len(value) > 0 {
+		i := strings.IndexAny(value, "HMS")
+		if i < 0 {
+			break
+		}
+		v, _ := strconv.ParseFloat(value[:i], 64)
+		switch value[i] {
+		case 'H':
+			minutes += v * 60
+		case 'M':
+			minutes += v
+		case 'S':
+			minutes += v / 60
+		}
+		value = value[i+1:]
+	}
+	return minutes
+}
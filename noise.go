@@ -0,0 +1,252 @@
+//  Copyright 2013 Thomas McGrew
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package mzlib
+
+import (
+	"math"
+	"sort"
+)
+
+// Estimates the noise level at each peak of a scan. The returned noise
+// levels are aligned with the intensity values.
+type NoiseEstimator func(mz []float64, intensity []float64) []float64
+
+// Creates a NoiseEstimator using the median and the median absolute
+// deviation of all intensities in the scan. The noise level is the median
+// plus the standard deviation estimated from the median absolute deviation.
+//
+// Return value:
+//   NoiseEstimator: The new NoiseEstimator
+func MadNoise() NoiseEstimator {
+	return func(mz []float64, intensity []float64) []float64 {
+		return constantNoise(robustNoise(intensity), len(intensity))
+	}
+}
+
+// Creates a NoiseEstimator using iterative sigma clipping. Intensities more
+// than k standard deviations above the mean are removed until none remain or
+// the number of iterations is reached. The noise level is the mean plus the
+// standard deviation of the remaining intensities.
+//
+// Parameters:
+//   k: The number of standard deviations above which values are clipped
+//   iterations: The maximum number of iterations
+//
+// Return value:
+//   NoiseEstimator: The new NoiseEstimator
+func SigmaClipNoise(k float64, iterations int) NoiseEstimator {
+	return func(mz []float64, intensity []float64) []float64 {
+		values := make([]float64, len(intensity))
+		copy(values, intensity)
+		var mean, sd float64
+		for i := 0; i <= iterations; i++ {
+			mean, sd = meanStdDev(values)
+			kept := values[:0]
+			for _, v := range values {
+				if v <= mean+k*sd {
+					kept = append(kept, v)
+				}
+			}
+			if len(kept) == len(values) || len(kept) == 0 {
+				break
+			}
+			values = kept
+		}
+		return constantNoise(mean+sd, len(intensity))
+	}
+}
+
+// Creates a NoiseEstimator using the median and median absolute deviation
+// of the intensities inside a window of m/z values around each peak, for
+// scans where the noise level varies with m/z.
+//
+// Parameters:
+//   width: The width of the window in m/z
+//
+// Return value:
+//   NoiseEstimator: The new NoiseEstimator
+func SlidingWindowNoise(width float64) NoiseEstimator {
+	return func(mz []float64, intensity []float64) []float64 {
+		s := Scan{MzArray: mz, IntensityArray: intensity}
+		sortedMz, sortedIntensity := s.sortedPeaks()
+		noise := make([]float64, len(mz))
+		for i, v := range mz {
+			start := sort.SearchFloat64s(sortedMz, v-width/2)
+			end := sort.SearchFloat64s(sortedMz, v+width/2)
+			for end < len(sortedMz) && sortedMz[end] <= v+width/2 {
+				end++
+			}
+			noise[i] = robustNoise(sortedIntensity[start:end])
+		}
+		return noise
+	}
+}
+
+// Calculates the signal to noise ratio of each peak in the scan.
+//
+// Parameters:
+//   noise: The NoiseEstimator used to estimate the noise level
+//
+// Return value:
+//   []float64: The signal to noise ratio of each peak
+func (s *Scan) SignalToNoise(noise NoiseEstimator) []float64 {
+	levels := noise(s.MzArray, s.IntensityArray)
+	ratios := make([]float64, len(s.IntensityArray))
+	for i, v := range s.IntensityArray {
+		if levels[i] > 0 {
+			ratios[i] = v / levels[i]
+		} else if v > 0 {
+			ratios[i] = math.Inf(1)
+		}
+	}
+	return ratios
+}
+
+// Removes any peaks with a signal to noise ratio below the cutoff
+//
+// Parameters:
+//   noise: The NoiseEstimator used to estimate the noise level
+//   minSignalToNoise: The minimum signal to noise ratio to be retained
+//
+// Return value:
+//   uint64: The number of peaks removed
+func (s *Scan) RemoveNoise(noise NoiseEstimator,
+	minSignalToNoise float64) uint64 {
+	ratios := s.SignalToNoise(noise)
+	return s.keepPeaks(func(i int) bool {
+		return ratios[i] >= minSignalToNoise
+	})
+}
+
+// Removes all but the most intense peaks in each window of m/z values. The
+// windows start at multiples of the width.
+//
+// Parameters:
+//   n: The number of peaks to retain in each window
+//   width: The width of each window in m/z, or 0 to use the whole scan
+//
+// Return value:
+//   uint64: The number of peaks removed
+func (s *Scan) TopPeaks(n int, width float64) uint64 {
+	windows := make(map[int64][]int)
+	for i, v := range s.MzArray {
+		var window int64
+		if width > 0 {
+			window = int64(math.Floor(v / width))
+		}
+		windows[window] = append(windows[window], i)
+	}
+	keep := make([]bool, len(s.MzArray))
+	for _, peaks := range windows {
+		sort.SliceStable(peaks, func(i, j int) bool {
+			return s.IntensityArray[peaks[i]] > s.IntensityArray[peaks[j]]
+		})
+		for i := 0; i < n && i < len(peaks); i++ {
+			keep[peaks[i]] = true
+		}
+	}
+	return s.keepPeaks(func(i int) bool {
+		return keep[i]
+	})
+}
+
+// Removes any peaks with a signal to noise ratio below the cutoff from every
+// scan
+//
+// Parameters:
+//   noise: The NoiseEstimator used to estimate the noise level
+//   minSignalToNoise: The minimum signal to noise ratio to be retained
+//
+// Return value:
+//   uint64: The number of peaks removed
+func (r *RawData) RemoveNoise(noise NoiseEstimator,
+	minSignalToNoise float64) uint64 {
+	removed := uint64(0)
+	for i := range r.Scans {
+		removed += r.Scans[i].RemoveNoise(noise, minSignalToNoise)
+	}
+	return removed
+}
+
+// Removes all but the most intense peaks in each window of m/z values from
+// every scan
+//
+// Parameters:
+//   n: The number of peaks to retain in each window
+//   width: The width of each window in m/z, or 0 to use the whole scan
+//
+// Return value:
+//   uint64: The number of peaks removed
+func (r *RawData) TopPeaks(n int, width float64) uint64 {
+	removed := uint64(0)
+	for i := range r.Scans {
+		removed += r.Scans[i].TopPeaks(n, width)
+	}
+	return removed
+}
+
+// Estimates a noise level as the median plus the standard deviation
+// estimated from the median absolute deviation.
+func robustNoise(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	m := median(values)
+	deviations := make([]float64, len(values))
+	for i, v := range values {
+		deviations[i] = math.Abs(v - m)
+	}
+	return m + 1.4826*median(deviations)
+}
+
+// Returns the median of the values without modifying them.
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
+
+// Returns the mean and standard deviation of the values.
+func meanStdDev(values []float64) (float64, float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+	var sum, squares float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	for _, v := range values {
+		squares += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(squares / float64(len(values)))
+}
+
+// Returns a noise level for each of the given number of peaks.
+func constantNoise(level float64, length int) []float64 {
+	noise := make([]float64, length)
+	for i := range noise {
+		noise[i] = level
+	}
+	return noise
+}
@@ -0,0 +1,271 @@
+//  Copyright 2013 Thomas McGrew
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package mzlib
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+const (
+	// The normalization methods for single scans.
+	TicNormalization int = iota
+	BasePeakNormalization
+	VectorNormalization
+	// The normalization methods for sets of runs.
+	MedianNormalization
+	TotalSignalNormalization
+	QuantileNormalization
+)
+
+// The name of the DataArray holding the factor applied to each peak by
+// QuantileNormalization
+const normalizationArray = "normalization factor"
+
+// Normalizes the intensities of the scan, so that the total intensity, the
+// highest intensity or the euclidean norm of the intensities is 1. The
+// factor applied is recorded in IntensityFactor, so it can be reversed by
+// Denormalize.
+//
+// Parameters:
+//   method: TicNormalization, BasePeakNormalization or VectorNormalization
+//
+// Return values:
+//   float64: The factor the intensities were multiplied by
+//   error: An error if the method cannot be applied to a single scan
+func (s *Scan) Normalize(method int) (float64, error) {
+	var total float64
+	switch method {
+	case TicNormalization:
+		total = s.TotalIntensity()
+	case BasePeakNormalization:
+		total = math.Max(s.PeakIntensity(), 0)
+	case VectorNormalization:
+		for _, v := range s.IntensityArray {
+			total += v * v
+		}
+		total = math.Sqrt(total)
+	default:
+		return 1, errors.New(fmt.Sprintf(
+			"Normalization method %d cannot be applied to a scan", method))
+	}
+	factor := 1.0
+	if total > 0 {
+		factor = 1 / total
+	}
+	s.scaleIntensity(factor)
+	return factor, nil
+}
+
+// Reverses any normalization of the intensities of the scan.
+func (s *Scan) Denormalize() {
+	if a, err := s.ExtraArray(normalizationArray); err == nil {
+		for i, v := range a.Values {
+			if v != 0 && i < len(s.IntensityArray) {
+				s.IntensityArray[i] /= v
+			}
+		}
+		for i := range s.ExtraArrays {
+			if &s.ExtraArrays[i] == a {
+				s.ExtraArrays = append(s.ExtraArrays[:i], s.ExtraArrays[i+1:]...)
+				break
+			}
+		}
+	}
+	if s.IntensityFactor != 0 {
+		for i := range s.IntensityArray {
+			s.IntensityArray[i] /= s.IntensityFactor
+		}
+	}
+	s.IntensityFactor = 0
+}
+
+// Normalizes the intensities of every scan in the data.
+//
+// Parameters:
+//   method: TicNormalization, BasePeakNormalization or VectorNormalization
+//
+// Return value:
+//   error: An error if the method cannot be applied to a single scan
+func (r *RawData) Normalize(method int) error {
+	for i := range r.Scans {
+		if _, err := r.Scans[i].Normalize(method); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reverses any normalization of the intensities of every scan in the data.
+func (r *RawData) Denormalize() {
+	for i := range r.Scans {
+		r.Scans[i].Denormalize()
+	}
+}
+
+// Normalizes the intensities of a set of runs so they can be compared. The
+// statistics are calculated from the MS1 scans, and every scan is scaled.
+// MedianNormalization scales each run so the median MS1 peak intensity is
+// the median of those of all the runs, and TotalSignalNormalization does
+// the same for the total MS1 intensity. QuantileNormalization replaces each
+// MS1 peak intensity with the mean intensity at the same quantile in every
+// run, recording the factor for each peak in an additional DataArray.
+//
+// Parameters:
+//   runs: The runs to normalize
+//   method: MedianNormalization, TotalSignalNormalization or
+//     QuantileNormalization
+//
+// Return values:
+//   []float64: The factor applied to each run, or nil for
+//     QuantileNormalization
+//   error: An error if the method cannot be applied to a set of runs
+func NormalizeRuns(runs []*RawData, method int) ([]float64, error) {
+	if method == QuantileNormalization {
+		quantileNormalize(runs)
+		return nil, nil
+	}
+	stats := make([]float64, len(runs))
+	for k, r := range runs {
+		switch method {
+		case MedianNormalization:
+			stats[k] = median(r.ms1Intensities())
+		case TotalSignalNormalization:
+			for _, v := range r.ms1Intensities() {
+				stats[k] += v
+			}
+		default:
+			return nil, errors.New(fmt.Sprintf(
+				"Normalization method %d cannot be applied to a set of runs",
+				method))
+		}
+	}
+	target := median(stats)
+	factors := make([]float64, len(runs))
+	for k, r := range runs {
+		factors[k] = 1
+		if stats[k] > 0 {
+			factors[k] = target / stats[k]
+		}
+		for i := range r.Scans {
+			r.Scans[i].scaleIntensity(factors[k])
+		}
+	}
+	return factors, nil
+}
+
+// Replaces the intensity of each MS1 peak with the mean intensity at the
+// same quantile in every run.
+func quantileNormalize(runs []*RawData) {
+	sorted := make([][]float64, len(runs))
+	length := 0
+	for k, r := range runs {
+		sorted[k] = r.ms1Intensities()
+		sort.Float64s(sorted[k])
+		if len(sorted[k]) > length {
+			length = len(sorted[k])
+		}
+	}
+	if length == 0 {
+		return
+	}
+	reference := make([]float64, length)
+	for i := range reference {
+		q := 0.0
+		if length > 1 {
+			q = float64(i) / float64(length-1)
+		}
+		var count float64
+		for _, values := range sorted {
+			if len(values) > 0 {
+				reference[i] += quantile(values, q)
+				count++
+			}
+		}
+		reference[i] /= count
+	}
+	for k, r := range runs {
+		values := sorted[k]
+		for i := range r.Scans {
+			s := &r.Scans[i]
+			if s.MsLevel != 1 {
+				continue
+			}
+			factors := make([]float64, len(s.IntensityArray))
+			for j, v := range s.IntensityArray {
+				factors[j] = 1
+				if v == 0 {
+					continue
+				}
+				// the mean rank of the intensity among the values
+				low := sort.SearchFloat64s(values, v)
+				high := sort.Search(len(values), func(n int) bool {
+					return values[n] > v
+				}) - 1
+				q := 0.0
+				if len(values) > 1 {
+					q = float64(low+high) / 2 / float64(len(values)-1)
+				}
+				normalized := quantile(reference, q)
+				factors[j] = normalized / v
+				s.IntensityArray[j] = normalized
+			}
+			if a, err := s.ExtraArray(normalizationArray); err == nil {
+				for j := range factors {
+					if j < len(a.Values) {
+						factors[j] *= a.Values[j]
+					}
+				}
+			}
+			s.SetExtraArray(DataArray{Name: normalizationArray,
+				Values: factors})
+		}
+	}
+}
+
+// Multiplies the intensities of the scan by a factor, recording the factor
+// in IntensityFactor.
+func (s *Scan) scaleIntensity(factor float64) {
+	for i := range s.IntensityArray {
+		s.IntensityArray[i] *= factor
+	}
+	if s.IntensityFactor == 0 {
+		s.IntensityFactor = 1
+	}
+	s.IntensityFactor *= factor
+}
+
+// Returns the intensities of all peaks in the MS1 scans of the data.
+func (r *RawData) ms1Intensities() []float64 {
+	values := make([]float64, 0)
+	for i := range r.Scans {
+		if r.Scans[i].MsLevel == 1 {
+			values = append(values, r.Scans[i].IntensityArray...)
+		}
+	}
+	return values
+}
+
+// Returns the value at a quantile of sorted values by linear interpolation
+func quantile(sorted []float64, q float64) float64 {
+	position := q * float64(len(sorted)-1)
+	i := int(math.Floor(position))
+	if i >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[i] + (sorted[i+1]-sorted[i])*(position-float64(i))
+}
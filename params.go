@@ -0,0 +1,163 @@
+//  Copyright 2013 Thomas McGrew
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package mzlib
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+)
+
+// Represents a single controlled vocabulary or user defined parameter which
+// was not mapped to one of the fixed fields when the data was decoded. User
+// defined parameters have an empty Accession.
+type Param struct {
+	CvLabel       string
+	Accession     string
+	Name          string
+	Value         string
+	UnitAccession string
+	Unit          string
+}
+
+// A collection of parameters attached to a RawData, Instrument or Scan.
+type Params []Param
+
+// Adds a parameter to the collection.
+//
+// Parameters:
+//   param: The parameter to add
+func (p *Params) Add(param Param) {
+	*p = append(*p, param)
+}
+
+// Finds a parameter in the collection. Parameters with a different
+// accession are matched by name using the PsiMs vocabulary.
+//
+// Parameters:
+//   key: The accession or name of the parameter to search for
+//
+// Return values:
+//   *Param: A pointer to the parameter, or nil if not found
+//   error: An error if the parameter was not found
+func (p *Params) Get(key string) (*Param, error) {
+	for i := range *p {
+		if (*p)[i].Name == key ||
+			PsiMs.Matches(key, (*p)[i].Accession, (*p)[i].Name) {
+			return &(*p)[i], nil
+		}
+	}
+	return nil, errors.New(fmt.Sprintf("Param '%s' Not Found", key))
+}
+
+// Finds the value of a parameter in the collection.
+//
+// Parameters:
+//   key: The accession or name of the parameter to search for
+//
+// Return values:
+//   string: The parameter's value, or an empty string if not found
+//   error: An error if the parameter was not found
+func (p *Params) Value(key string) (string, error) {
+	param, err := p.Get(key)
+	if err != nil {
+		return "", err
+	}
+	return param.Value, nil
+}
+
+// Creates a copy of this collection.
+func (p Params) Clone() Params {
+	if p == nil {
+		return nil
+	}
+	cpy := make(Params, len(p))
+	copy(cpy, p)
+	return cpy
+}
+
+// Renders the parameters as mzData cvParam and userParam elements.
+//
+// Parameters:
+//   indent: The indentation to prefix each element with
+//   exclude: The accessions or names of any parameters which should not be
+//     written
+//
+// Return value:
+//   string: The rendered elements, each preceded by a newline
+func (p *Params) mzData(indent string, exclude ...string) string {
+	out := new(bytes.Buffer)
+outer:
+	for _, v := range *p {
+		for _, e := range exclude {
+			if v.Name == e || PsiMs.Matches(e, v.Accession, v.Name) {
+				continue outer
+			}
+		}
+		if v.Accession != "" {
+			cvLabel := v.CvLabel
+			if cvLabel == "" {
+				cvLabel = "psi"
+			}
+			fmt.Fprintf(out,
+				"\n%s<cvParam cvLabel=\"%s\" accession=\"%s\" name=\"%s\" value=\"%s\" />",
+				indent, escape(cvLabel), escape(v.Accession), escape(v.Name),
+				escape(v.Value))
+		} else {
+			fmt.Fprintf(out, "\n%s<userParam name=\"%s\" value=\"%s\" />",
+				indent, escape(v.Name), escape(v.Value))
+		}
+	}
+	return out.String()
+}
+
+// Renders the parameters as mzML cvParam and userParam elements.
+//
+// Parameters:
+//   indent: The indentation to prefix each element with
+//
+// Return value:
+//   string: The rendered elements, each preceded by a newline
+func (p *Params) mzML(indent string) string {
+	out := new(bytes.Buffer)
+	for _, v := range *p {
+		unit := ""
+		if v.UnitAccession != "" {
+			unit = fmt.Sprintf(` unitCvRef="%s" unitAccession="%s" unitName="%s"`,
+				cvRef(v.UnitAccession), escape(v.UnitAccession), escape(v.Unit))
+		} else if v.Unit != "" {
+			unit = fmt.Sprintf(` unitName="%s"`, escape(v.Unit))
+		}
+		if v.Accession != "" {
+			accession := cvAccession(v.Accession)
+			fmt.Fprintf(out,
+				"\n%s<cvParam cvRef=\"%s\" accession=\"%s\" name=\"%s\" value=\"%s\"%s/>",
+				indent, cvRef(accession), escape(accession), escape(v.Name),
+				escape(v.Value), unit)
+		} else {
+			fmt.Fprintf(out, "\n%s<userParam name=\"%s\" value=\"%s\"%s/>",
+				indent, escape(v.Name), escape(v.Value), unit)
+		}
+	}
+	return out.String()
+}
+
+// Escapes a string for use in xml character data or attribute values.
+func escape(s string) string {
+	out := new(bytes.Buffer)
+	xml.EscapeText(out, []byte(s))
+	return out.String()
+}
@@ -0,0 +1,160 @@
+//  Copyright 2013 Thomas McGrew
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package mzlib
+
+const (
+	// Activation methods for a Precursor.
+	ActivationCID   string = "CID"
+	ActivationHCD   string = "HCD"
+	ActivationETD   string = "ETD"
+	ActivationECD   string = "ECD"
+	ActivationEThcD string = "EThcD"
+	ActivationIRMPD string = "IRMPD"
+)
+
+// The PSI-MS accessions of the activation methods.
+var activationAccessions = map[string]string{
+	ActivationCID:   "MS:1000133",
+	ActivationHCD:   "MS:1000422",
+	ActivationETD:   "MS:1000598",
+	ActivationECD:   "MS:1000250",
+	ActivationEThcD: "MS:1002631",
+	ActivationIRMPD: "MS:1000262",
+}
+
+// Represents an ion which was selected and activated to produce a scan.
+// IsolationParams, SelectedIonParams and ActivationParams hold any
+// additional parameters of the isolation window, the selected ion and the
+// activation.
+type Precursor struct {
+	ParentScan           uint64
+	Mz                   float64
+	Intensity            float64
+	Charge               int8
+	PossibleCharges      []int8
+	IsolationTarget      float64
+	IsolationLowerOffset float64
+	IsolationUpperOffset float64
+	ActivationMethod     string
+	CollisionEnergy      float64
+	IsolationParams      Params
+	SelectedIonParams    Params
+	ActivationParams     Params
+}
+
+// Creates a copy of this Precursor
+func (p *Precursor) Clone() Precursor {
+	cpy := *p
+	if p.PossibleCharges != nil {
+		cpy.PossibleCharges = make([]int8, len(p.PossibleCharges))
+		copy(cpy.PossibleCharges, p.PossibleCharges)
+	}
+	cpy.IsolationParams = p.IsolationParams.Clone()
+	cpy.SelectedIonParams = p.SelectedIonParams.Clone()
+	cpy.ActivationParams = p.ActivationParams.Clone()
+	return cpy
+}
+
+// Returns the width of the isolation window
+//
+// Return value:
+//   float64: The sum of the lower and upper isolation window offsets
+func (p *Precursor) IsolationWidth() float64 {
+	return p.IsolationLowerOffset + p.IsolationUpperOffset
+}
+
+// Adds a precursor to the scan. The ParentScan, PrecursorMz,
+// PrecursorIntensity, PrecursorCharge, IsolationWidth, ActivationMethod and
+// CollisionEnergy fields of the scan are set from the first precursor added.
+//
+// Parameters:
+//   p: The precursor to add
+func (s *Scan) AddPrecursor(p Precursor) {
+	s.Precursors = append(s.Precursors, p)
+	if len(s.Precursors) == 1 {
+		s.ParentScan = p.ParentScan
+		s.PrecursorMz = p.Mz
+		s.PrecursorIntensity = p.Intensity
+		s.PrecursorCharge = p.Charge
+		s.IsolationWidth = p.IsolationWidth()
+		s.ActivationMethod = p.ActivationMethod
+		s.CollisionEnergy = p.CollisionEnergy
+	}
+}
+
+// Returns the precursors of the scan for encoding, with the first precursor
+// updated from the convenience fields of the scan. If the Precursors slice is
+// empty, a single precursor is created from the convenience fields when they
+// have been set.
+func (s *Scan) precursors() []Precursor {
+	if len(s.Precursors) == 0 {
+		if s.ParentScan == 0 && s.PrecursorMz == 0 {
+			return s.Precursors
+		}
+		return []Precursor{Precursor{
+			ParentScan:           s.ParentScan,
+			Mz:                   s.PrecursorMz,
+			Intensity:            s.PrecursorIntensity,
+			Charge:               s.PrecursorCharge,
+			IsolationTarget:      s.PrecursorMz,
+			IsolationLowerOffset: s.IsolationWidth / 2,
+			IsolationUpperOffset: s.IsolationWidth / 2,
+			ActivationMethod:     s.ActivationMethod,
+			CollisionEnergy:      s.CollisionEnergy,
+		}}
+	}
+	precursors := make([]Precursor, len(s.Precursors))
+	copy(precursors, s.Precursors)
+	p := &precursors[0]
+	// an isolation window centered on the precursor follows it
+	if p.IsolationTarget == p.Mz {
+		p.IsolationTarget = s.PrecursorMz
+	}
+	if p.IsolationWidth() != s.IsolationWidth {
+		p.IsolationLowerOffset = s.IsolationWidth / 2
+		p.IsolationUpperOffset = s.IsolationWidth / 2
+	}
+	p.ParentScan = s.ParentScan
+	p.Mz = s.PrecursorMz
+	p.Intensity = s.PrecursorIntensity
+	p.Charge = s.PrecursorCharge
+	p.ActivationMethod = s.ActivationMethod
+	p.CollisionEnergy = s.CollisionEnergy
+	return precursors
+}
+
+// Converts the name or accession of a dissociation method to one of the
+// Activation constants, using the PsiMs vocabulary.
+//
+// Parameters:
+//   method: The name, synonym or accession of the method
+//
+// Return value:
+//   string: The Activation constant, or the method unchanged if it is not
+//     recognized
+func activationMethod(method string) string {
+	term, err := PsiMs.Term(method)
+	if err != nil {
+		term, err = PsiMs.Find(method)
+	}
+	if err == nil {
+		for k, v := range activationAccessions {
+			if v == term.Id {
+				return k
+			}
+		}
+	}
+	return method
+}
@@ -0,0 +1,746 @@
+//  Copyright 2013 Thomas McGrew
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package mzlib
+
+// The subset of the PSI-MS controlled vocabulary which is bundled with the
+// library. It contains the terms used by the decoders and encoders. Load the
+// full psi-ms.obo file with PsiMs.ReadObo for complete coverage.
+const psiMsObo = `format-version: 1.2
+default-namespace: MS
+ontology: ms
+
+[Term]
+id: MS:0000000
+name: Proteomics Standards Initiative Mass Spectrometry Vocabularies
+
+[Term]
+id: MS:1000031
+name: instrument model
+is_a: MS:0000000 ! Proteomics Standards Initiative Mass Spectrometry Vocabularies
+
+[Term]
+id: MS:1000443
+name: mass analyzer type
+is_a: MS:0000000 ! Proteomics Standards Initiative Mass Spectrometry Vocabularies
+
+[Term]
+id: MS:1000079
+name: fourier transform ion cyclotron resonance mass spectrometer
+synonym: "FT_ICR" EXACT []
+synonym: "FTICR" EXACT []
+is_a: MS:1000443 ! mass analyzer type
+
+[Term]
+id: MS:1000080
+name: magnetic sector
+is_a: MS:1000443 ! mass analyzer type
+
+[Term]
+id: MS:1000081
+name: quadrupole
+is_a: MS:1000443 ! mass analyzer type
+
+[Term]
+id: MS:1000084
+name: time-of-flight
+synonym: "TOF" EXACT []
+is_a: MS:1000443 ! mass analyzer type
+
+[Term]
+id: MS:1000264
+name: ion trap
+is_a: MS:1000443 ! mass analyzer type
+
+[Term]
+id: MS:1000082
+name: quadrupole ion trap
+synonym: "Paul Ion trap" EXACT []
+is_a: MS:1000264 ! ion trap
+
+[Term]
+id: MS:1000291
+name: linear ion trap
+is_a: MS:1000264 ! ion trap
+
+[Term]
+id: MS:1000078
+name: axial ejection linear ion trap
+is_a: MS:1000291 ! linear ion trap
+
+[Term]
+id: MS:1000083
+name: radial ejection linear ion trap
+is_a: MS:1000291 ! linear ion trap
+
+[Term]
+id: MS:1000484
+name: orbitrap
+is_a: MS:1000443 ! mass analyzer type
+
+[Term]
+id: MS:1000026
+name: detector type
+is_a: MS:0000000 ! Proteomics Standards Initiative Mass Spectrometry Vocabularies
+
+[Term]
+id: MS:1000110
+name: daly detector
+is_a: MS:1000026 ! detector type
+
+[Term]
+id: MS:1000114
+name: microchannel plate detector
+synonym: "MCP" EXACT []
+is_a: MS:1000026 ! detector type
+
+[Term]
+id: MS:1000116
+name: photomultiplier
+synonym: "PMT" EXACT []
+is_a: MS:1000026 ! detector type
+
+[Term]
+id: MS:1000253
+name: electron multiplier
+synonym: "EM" EXACT []
+is_a: MS:1000026 ! detector type
+
+[Term]
+id: MS:1000624
+name: inductive detector
+synonym: "image current detector" EXACT []
+is_a: MS:1000026 ! detector type
+
+[Term]
+id: MS:1000008
+name: ionization type
+is_a: MS:0000000 ! Proteomics Standards Initiative Mass Spectrometry Vocabularies
+
+[Term]
+id: MS:1000070
+name: atmospheric pressure chemical ionization
+synonym: "APCI" EXACT []
+is_a: MS:1000008 ! ionization type
+
+[Term]
+id: MS:1000071
+name: chemical ionization
+synonym: "CI" EXACT []
+is_a: MS:1000008 ! ionization type
+
+[Term]
+id: MS:1000073
+name: electrospray ionization
+synonym: "ESI" EXACT []
+is_a: MS:1000008 ! ionization type
+
+[Term]
+id: MS:1000075
+name: matrix-assisted laser desorption ionization
+synonym: "MALDI" EXACT []
+is_a: MS:1000008 ! ionization type
+
+[Term]
+id: MS:1000389
+name: electron ionization
+synonym: "EI" EXACT []
+is_a: MS:1000008 ! ionization type
+
+[Term]
+id: MS:1000398
+name: nanoelectrospray
+synonym: "nanospray" EXACT []
+is_a: MS:1000073 ! electrospray ionization
+
+[Term]
+id: MS:1000465
+name: scan polarity
+is_a: MS:0000000 ! Proteomics Standards Initiative Mass Spectrometry Vocabularies
+
+[Term]
+id: MS:1000129
+name: negative scan
+is_a: MS:1000465 ! scan polarity
+
+[Term]
+id: MS:1000130
+name: positive scan
+is_a: MS:1000465 ! scan polarity
+
+[Term]
+id: MS:1000044
+name: dissociation method
+is_a: MS:0000000 ! Proteomics Standards Initiative Mass Spectrometry Vocabularies
+
+[Term]
+id: MS:1000133
+name: collision-induced dissociation
+synonym: "CID" EXACT []
+is_a: MS:1000044 ! dissociation method
+
+[Term]
+id: MS:1000422
+name: beam-type collision-induced dissociation
+synonym: "HCD" EXACT []
+is_a: MS:1000133 ! collision-induced dissociation
+
+[Term]
+id: MS:1002472
+name: trap-type collision-induced dissociation
+is_a: MS:1000133 ! collision-induced dissociation
+
+[Term]
+id: MS:1000250
+name: electron capture dissociation
+synonym: "ECD" EXACT []
+is_a: MS:1000044 ! dissociation method
+
+[Term]
+id: MS:1000262
+name: infrared multiphoton dissociation
+synonym: "IRMPD" EXACT []
+is_a: MS:1000044 ! dissociation method
+
+[Term]
+id: MS:1000598
+name: electron transfer dissociation
+synonym: "ETD" EXACT []
+is_a: MS:1000044 ! dissociation method
+
+[Term]
+id: MS:1002631
+name: Electron-Transfer/Higher-Energy Collision Dissociation (EThcD)
+synonym: "EThcD" EXACT []
+is_a: MS:1000044 ! dissociation method
+
+[Term]
+id: MS:1000525
+name: spectrum representation
+is_a: MS:0000000 ! Proteomics Standards Initiative Mass Spectrometry Vocabularies
+
+[Term]
+id: MS:1000127
+name: centroid spectrum
+synonym: "Discrete Mass Spectrum" EXACT []
+is_a: MS:1000525 ! spectrum representation
+
+[Term]
+id: MS:1000128
+name: profile spectrum
+synonym: "continuous mass spectrum" EXACT []
+is_a: MS:1000525 ! spectrum representation
+
+[Term]
+id: MS:1000559
+name: spectrum type
+is_a: MS:0000000 ! Proteomics Standards Initiative Mass Spectrometry Vocabularies
+
+[Term]
+id: MS:1000579
+name: MS1 spectrum
+synonym: "full spectrum" EXACT []
+is_a: MS:1000559 ! spectrum type
+
+[Term]
+id: MS:1000580
+name: MSn spectrum
+is_a: MS:1000559 ! spectrum type
+
+[Term]
+id: MS:1000582
+name: SIM spectrum
+is_a: MS:1000559 ! spectrum type
+
+[Term]
+id: MS:1000583
+name: SRM spectrum
+is_a: MS:1000559 ! spectrum type
+
+[Term]
+id: MS:1000626
+name: chromatogram type
+is_a: MS:0000000 ! Proteomics Standards Initiative Mass Spectrometry Vocabularies
+
+[Term]
+id: MS:1000235
+name: total ion current chromatogram
+synonym: "TIC" EXACT []
+is_a: MS:1000626 ! chromatogram type
+
+[Term]
+id: MS:1000627
+name: selected ion current chromatogram
+synonym: "SIC" EXACT []
+is_a: MS:1000626 ! chromatogram type
+
+[Term]
+id: MS:1000628
+name: basepeak chromatogram
+synonym: "BPC" EXACT []
+is_a: MS:1000626 ! chromatogram type
+
+[Term]
+id: MS:1001473
+name: selected reaction monitoring chromatogram
+synonym: "SRM chromatogram" EXACT []
+is_a: MS:1000626 ! chromatogram type
+
+[Term]
+id: MS:1000513
+name: binary data array
+is_a: MS:0000000 ! Proteomics Standards Initiative Mass Spectrometry Vocabularies
+
+[Term]
+id: MS:1000514
+name: m/z array
+is_a: MS:1000513 ! binary data array
+relationship: has_units MS:1000040 ! m/z
+
+[Term]
+id: MS:1000515
+name: intensity array
+is_a: MS:1000513 ! binary data array
+relationship: has_units MS:1000131 ! number of detector counts
+
+[Term]
+id: MS:1000516
+name: charge array
+is_a: MS:1000513 ! binary data array
+
+[Term]
+id: MS:1000517
+name: signal to noise array
+is_a: MS:1000513 ! binary data array
+
+[Term]
+id: MS:1000595
+name: time array
+is_a: MS:1000513 ! binary data array
+relationship: has_units UO:0000010 ! second
+relationship: has_units UO:0000031 ! minute
+
+[Term]
+id: MS:1000786
+name: non-standard data array
+is_a: MS:1000513 ! binary data array
+
+[Term]
+id: MS:1002529
+name: resolution array
+is_a: MS:1000513 ! binary data array
+
+[Term]
+id: MS:1002530
+name: baseline array
+is_a: MS:1000513 ! binary data array
+
+[Term]
+id: MS:1002742
+name: noise array
+is_a: MS:1000513 ! binary data array
+
+[Term]
+id: MS:1002893
+name: ion mobility array
+is_a: MS:1000513 ! binary data array
+
+[Term]
+id: MS:1002477
+name: mean ion mobility drift time array
+is_a: MS:1002893 ! ion mobility array
+relationship: has_units UO:0000028 ! millisecond
+
+[Term]
+id: MS:1002816
+name: mean ion mobility array
+is_a: MS:1002893 ! ion mobility array
+
+[Term]
+id: MS:1003006
+name: mean inverse reduced ion mobility array
+is_a: MS:1002893 ! ion mobility array
+relationship: has_units MS:1002814 ! volt-second per square centimeter
+
+[Term]
+id: MS:1003007
+name: raw ion mobility array
+is_a: MS:1002893 ! ion mobility array
+
+[Term]
+id: MS:1003008
+name: raw inverse reduced ion mobility array
+is_a: MS:1002893 ! ion mobility array
+relationship: has_units MS:1002814 ! volt-second per square centimeter
+
+[Term]
+id: MS:1000518
+name: binary data type
+is_a: MS:0000000 ! Proteomics Standards Initiative Mass Spectrometry Vocabularies
+
+[Term]
+id: MS:1000519
+name: 32-bit integer
+is_a: MS:1000518 ! binary data type
+
+[Term]
+id: MS:1000521
+name: 32-bit float
+is_a: MS:1000518 ! binary data type
+
+[Term]
+id: MS:1000522
+name: 64-bit integer
+is_a: MS:1000518 ! binary data type
+
+[Term]
+id: MS:1000523
+name: 64-bit float
+is_a: MS:1000518 ! binary data type
+
+[Term]
+id: MS:1000572
+name: binary data compression type
+is_a: MS:0000000 ! Proteomics Standards Initiative Mass Spectrometry Vocabularies
+
+[Term]
+id: MS:1000574
+name: zlib compression
+is_a: MS:1000572 ! binary data compression type
+
+[Term]
+id: MS:1000576
+name: no compression
+is_a: MS:1000572 ! binary data compression type
+
+[Term]
+id: MS:1000503
+name: scan attribute
+is_a: MS:0000000 ! Proteomics Standards Initiative Mass Spectrometry Vocabularies
+
+[Term]
+id: MS:1000016
+name: scan start time
+is_a: MS:1000503 ! scan attribute
+relationship: has_units UO:0000010 ! second
+relationship: has_units UO:0000031 ! minute
+
+[Term]
+id: MS:1000512
+name: filter string
+is_a: MS:1000503 ! scan attribute
+
+[Term]
+id: MS:1000927
+name: ion injection time
+is_a: MS:1000503 ! scan attribute
+relationship: has_units UO:0000028 ! millisecond
+
+[Term]
+id: MS:1002476
+name: ion mobility drift time
+is_a: MS:1000503 ! scan attribute
+relationship: has_units UO:0000028 ! millisecond
+
+[Term]
+id: MS:1002815
+name: inverse reduced ion mobility
+is_a: MS:1000503 ! scan attribute
+relationship: has_units MS:1002814 ! volt-second per square centimeter
+
+[Term]
+id: MS:1001581
+name: FAIMS compensation voltage
+is_a: MS:1000503 ! scan attribute
+relationship: has_units UO:0000218 ! volt
+
+[Term]
+id: MS:1000499
+name: spectrum attribute
+is_a: MS:0000000 ! Proteomics Standards Initiative Mass Spectrometry Vocabularies
+
+[Term]
+id: MS:1000511
+name: ms level
+is_a: MS:1000499 ! spectrum attribute
+
+[Term]
+id: MS:1000285
+name: total ion current
+is_a: MS:1000499 ! spectrum attribute
+
+[Term]
+id: MS:1000504
+name: base peak m/z
+is_a: MS:1000499 ! spectrum attribute
+relationship: has_units MS:1000040 ! m/z
+
+[Term]
+id: MS:1000505
+name: base peak intensity
+is_a: MS:1000499 ! spectrum attribute
+relationship: has_units MS:1000131 ! number of detector counts
+
+[Term]
+id: MS:1000527
+name: highest observed m/z
+is_a: MS:1000499 ! spectrum attribute
+relationship: has_units MS:1000040 ! m/z
+
+[Term]
+id: MS:1000528
+name: lowest observed m/z
+is_a: MS:1000499 ! spectrum attribute
+relationship: has_units MS:1000040 ! m/z
+
+[Term]
+id: MS:1000549
+name: selection window attribute
+is_a: MS:0000000 ! Proteomics Standards Initiative Mass Spectrometry Vocabularies
+
+[Term]
+id: MS:1000500
+name: scan window upper limit
+is_a: MS:1000549 ! selection window attribute
+relationship: has_units MS:1000040 ! m/z
+
+[Term]
+id: MS:1000501
+name: scan window lower limit
+is_a: MS:1000549 ! selection window attribute
+relationship: has_units MS:1000040 ! m/z
+
+[Term]
+id: MS:1000792
+name: isolation window attribute
+is_a: MS:0000000 ! Proteomics Standards Initiative Mass Spectrometry Vocabularies
+
+[Term]
+id: MS:1000827
+name: isolation window target m/z
+is_a: MS:1000792 ! isolation window attribute
+relationship: has_units MS:1000040 ! m/z
+
+[Term]
+id: MS:1000828
+name: isolation window lower offset
+is_a: MS:1000792 ! isolation window attribute
+relationship: has_units MS:1000040 ! m/z
+
+[Term]
+id: MS:1000829
+name: isolation window upper offset
+is_a: MS:1000792 ! isolation window attribute
+relationship: has_units MS:1000040 ! m/z
+
+[Term]
+id: MS:1000455
+name: ion selection attribute
+is_a: MS:0000000 ! Proteomics Standards Initiative Mass Spectrometry Vocabularies
+
+[Term]
+id: MS:1000040
+name: m/z
+synonym: "mass-to-charge ratio" EXACT []
+synonym: "Th" EXACT []
+is_a: MS:1000455 ! ion selection attribute
+is_a: UO:0000000 ! unit
+
+[Term]
+id: MS:1000041
+name: charge state
+is_a: MS:1000455 ! ion selection attribute
+
+[Term]
+id: MS:1000042
+name: peak intensity
+is_a: MS:1000455 ! ion selection attribute
+relationship: has_units MS:1000131 ! number of detector counts
+
+[Term]
+id: MS:1000633
+name: possible charge state
+is_a: MS:1000455 ! ion selection attribute
+
+[Term]
+id: MS:1000744
+name: selected ion m/z
+is_a: MS:1000455 ! ion selection attribute
+relationship: has_units MS:1000040 ! m/z
+
+[Term]
+id: MS:1000510
+name: precursor activation attribute
+is_a: MS:0000000 ! Proteomics Standards Initiative Mass Spectrometry Vocabularies
+
+[Term]
+id: MS:1000045
+name: collision energy
+is_a: MS:1000510 ! precursor activation attribute
+relationship: has_units UO:0000266 ! electronvolt
+
+[Term]
+id: MS:1000138
+name: normalized collision energy
+is_a: MS:1000510 ! precursor activation attribute
+relationship: has_units UO:0000187 ! percent
+
+[Term]
+id: MS:1000543
+name: data processing action
+is_a: MS:0000000 ! Proteomics Standards Initiative Mass Spectrometry Vocabularies
+
+[Term]
+id: MS:1000033
+name: deisotoping
+is_a: MS:1000543 ! data processing action
+
+[Term]
+id: MS:1000034
+name: charge deconvolution
+is_a: MS:1000543 ! data processing action
+
+[Term]
+id: MS:1000035
+name: peak picking
+synonym: "centroiding" EXACT []
+is_a: MS:1000543 ! data processing action
+
+[Term]
+id: MS:1000592
+name: smoothing
+is_a: MS:1000543 ! data processing action
+
+[Term]
+id: MS:1000593
+name: baseline reduction
+is_a: MS:1000543 ! data processing action
+
+[Term]
+id: MS:1001484
+name: intensity normalization
+is_a: MS:1000543 ! data processing action
+
+[Term]
+id: MS:1000795
+name: no combination
+is_a: MS:0000000 ! Proteomics Standards Initiative Mass Spectrometry Vocabularies
+
+[Term]
+id: MS:1000544
+name: Conversion to mzML
+is_a: MS:1000543 ! data processing action
+
+[Term]
+id: MS:1000010
+name: analyzer type
+is_a: MS:0000000 ! Proteomics Standards Initiative Mass Spectrometry Vocabularies
+is_obsolete: true
+replaced_by: MS:1000443
+
+[Term]
+id: MS:1000029
+name: sampling frequency
+is_a: MS:0000000 ! Proteomics Standards Initiative Mass Spectrometry Vocabularies
+
+[Term]
+id: MS:1000036
+name: scan mode
+is_a: MS:0000000 ! Proteomics Standards Initiative Mass Spectrometry Vocabularies
+is_obsolete: true
+
+[Term]
+id: MS:1000037
+name: polarity
+is_a: MS:0000000 ! Proteomics Standards Initiative Mass Spectrometry Vocabularies
+is_obsolete: true
+replaced_by: MS:1000465
+
+[Term]
+id: MS:1000038
+name: time in minutes
+is_a: MS:0000000 ! Proteomics Standards Initiative Mass Spectrometry Vocabularies
+relationship: has_units UO:0000031 ! minute
+is_obsolete: true
+
+[Term]
+id: MS:1000039
+name: time in seconds
+is_a: MS:0000000 ! Proteomics Standards Initiative Mass Spectrometry Vocabularies
+relationship: has_units UO:0000010 ! second
+is_obsolete: true
+
+[Term]
+id: MS:1000131
+name: number of detector counts
+synonym: "counts" EXACT []
+is_a: UO:0000000 ! unit
+
+[Term]
+id: MS:1002814
+name: volt-second per square centimeter
+synonym: "Vs/cm^2" EXACT []
+is_a: UO:0000000 ! unit
+
+[Term]
+id: UO:0000000
+name: unit
+
+[Term]
+id: UO:0000010
+name: second
+synonym: "s" EXACT []
+is_a: UO:0000000 ! unit
+
+[Term]
+id: UO:0000028
+name: millisecond
+synonym: "ms" EXACT []
+is_a: UO:0000000 ! unit
+
+[Term]
+id: UO:0000031
+name: minute
+synonym: "min" EXACT []
+is_a: UO:0000000 ! unit
+
+[Term]
+id: UO:0000169
+name: parts per million
+synonym: "ppm" EXACT []
+is_a: UO:0000000 ! unit
+
+[Term]
+id: UO:0000187
+name: percent
+is_a: UO:0000000 ! unit
+
+[Term]
+id: UO:0000218
+name: volt
+synonym: "V" EXACT []
+is_a: UO:0000000 ! unit
+
+[Term]
+id: UO:0000221
+name: dalton
+synonym: "Da" EXACT []
+is_a: UO:0000000 ! unit
+
+[Term]
+id: UO:0000266
+name: electronvolt
+synonym: "eV" EXACT []
+is_a: UO:0000000 ! unit
+`
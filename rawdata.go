@@ -28,22 +28,31 @@ const (
 
 // Represents the raw data from a mass spectrometry file.
 type RawData struct {
-	Filename   string
-	SourceFile string
-	Instrument Instrument
-	ScanCount  uint64
-	Scans      []Scan
+	Filename      string
+	SourceFile    string
+	Instrument    Instrument
+	ScanCount     uint64
+	Params        Params
+	Scans         []Scan
+	Chromatograms []Chromatogram
+	Alignment     *RetentionTimeTransform
 }
 
-// Represents instrument metadata from the read in file.
+// Represents instrument metadata from the read in file. SourceParams,
+// AnalyzerParams and DetectorParams hold any additional parameters of the
+// instrument components, and Params any others describing the instrument.
 type Instrument struct {
-	Manufacturer string
-	Model        string
-	MassAnalyzer string
-	Detector     string
-	Resolution   float64
-	Accuracy     float64
-	Ionization   string
+	Manufacturer   string
+	Model          string
+	MassAnalyzer   string
+	Detector       string
+	Resolution     float64
+	Accuracy       float64
+	Ionization     string
+	Params         Params
+	SourceParams   Params
+	AnalyzerParams Params
+	DetectorParams Params
 }
 
 // Creates a copy of this RawData object
@@ -52,6 +61,7 @@ func (r *RawData) Clone() RawData {
 	cpy.Filename = r.Filename
 	cpy.SourceFile = r.SourceFile
 	cpy.ScanCount = r.ScanCount
+	cpy.Params = r.Params.Clone()
 	cpy.Instrument.Manufacturer = r.Instrument.Manufacturer
 	cpy.Instrument.Model = r.Instrument.Model
 	cpy.Instrument.MassAnalyzer = r.Instrument.MassAnalyzer
@@ -59,9 +69,19 @@ func (r *RawData) Clone() RawData {
 	cpy.Instrument.Resolution = r.Instrument.Resolution
 	cpy.Instrument.Accuracy = r.Instrument.Accuracy
 	cpy.Instrument.Ionization = r.Instrument.Ionization
+	cpy.Instrument.Params = r.Instrument.Params.Clone()
+	cpy.Instrument.SourceParams = r.Instrument.SourceParams.Clone()
+	cpy.Instrument.AnalyzerParams = r.Instrument.AnalyzerParams.Clone()
+	cpy.Instrument.DetectorParams = r.Instrument.DetectorParams.Clone()
 	for _, s := range r.Scans {
 		cpy.Scans = append(cpy.Scans, *s.Clone())
 	}
+	for _, c := range r.Chromatograms {
+		cpy.Chromatograms = append(cpy.Chromatograms, *c.Clone())
+	}
+	if r.Alignment != nil {
+		cpy.Alignment = r.Alignment.Clone()
+	}
 	return cpy
 }
 
@@ -70,6 +90,7 @@ func (r *RawData) Level1() RawData {
 	cpy := RawData{}
 	cpy.Filename = r.Filename
 	cpy.SourceFile = r.SourceFile
+	cpy.Params = r.Params.Clone()
 	cpy.Instrument.Manufacturer = r.Instrument.Manufacturer
 	cpy.Instrument.Model = r.Instrument.Model
 	cpy.Instrument.MassAnalyzer = r.Instrument.MassAnalyzer
@@ -77,11 +98,21 @@ func (r *RawData) Level1() RawData {
 	cpy.Instrument.Resolution = r.Instrument.Resolution
 	cpy.Instrument.Accuracy = r.Instrument.Accuracy
 	cpy.Instrument.Ionization = r.Instrument.Ionization
+	cpy.Instrument.Params = r.Instrument.Params.Clone()
+	cpy.Instrument.SourceParams = r.Instrument.SourceParams.Clone()
+	cpy.Instrument.AnalyzerParams = r.Instrument.AnalyzerParams.Clone()
+	cpy.Instrument.DetectorParams = r.Instrument.DetectorParams.Clone()
 	for _, s := range r.Scans {
     if s.MsLevel == 1 {
       cpy.Scans = append(cpy.Scans, *s.Clone())
     }
 	}
+	for _, c := range r.Chromatograms {
+		cpy.Chromatograms = append(cpy.Chromatograms, *c.Clone())
+	}
+	if r.Alignment != nil {
+		cpy.Alignment = r.Alignment.Clone()
+	}
 	cpy.ScanCount = uint64(len(cpy.Scans))
 	return cpy
 }
@@ -189,6 +220,33 @@ func (r *RawData) OnlyMz(minMz float64, maxMz float64) uint64 {
 	return removed
 }
 
+// Centralizes every continuous scan in the data, converting from continuous
+// to discrete data. The scans are processed in parallel.
+//
+// Parameters:
+//   accuracy: The accuracy of the instrument which collected the values. All
+//     m/z values within this range of the local peak intensity will be merged.
+//
+// Return value:
+//   uint64: The number of scans centralized
+func (r *RawData) Centralize(accuracy float64) uint64 {
+	var chans []chan bool
+	for i := range r.Scans {
+		if r.Scans[i].Continuous {
+			c := make(chan bool)
+			chans = append(chans, c)
+			go func(s *Scan) {
+				s.Centralize(accuracy)
+				c <- true
+			}(&r.Scans[i])
+		}
+	}
+	for _, c := range chans {
+		<-c
+	}
+	return uint64(len(chans))
+}
+
 // Returns a selected ion chromatogram for the data.
 //
 // Parameters:
@@ -0,0 +1,263 @@
+//  Copyright 2013 Thomas McGrew
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package mzlib
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+const (
+	// The models of m/z error used by Recalibrate, as the order of the
+	// polynomial of the ppm error in m/z.
+	ConstantCalibration  int = 0
+	LinearCalibration    int = 1
+	QuadraticCalibration int = 2
+)
+
+// Summarizes m/z errors in parts per million
+type PpmErrors struct {
+	Count  int
+	Mean   float64
+	StdDev float64
+	Median float64
+	Rms    float64
+	Max    float64
+}
+
+// Reports the m/z errors of the calibrant ions found by Recalibrate before
+// and after the correction.
+type CalibrationReport struct {
+	CalibratedScans   int
+	UncalibratedScans int
+	Before            PpmErrors
+	After             PpmErrors
+}
+
+// A calibrant ion found in a scan
+type calibrantMatch struct {
+	scan     int
+	expected float64
+	measured float64
+}
+
+// A fit of the ppm error as a polynomial of the m/z value. The m/z values
+// are centered and scaled before fitting to keep the fit well conditioned.
+type calibration struct {
+	center       float64
+	scale        float64
+	coefficients []float64
+}
+
+// Recalibrates the m/z values of the data using known calibrant ions, such
+// as lock masses, internal standards or background ions. The most intense
+// peak within the tolerance of each calibrant is found in every MS1 scan,
+// and the ppm error is fit as a polynomial of m/z to the matches of the MS1
+// scans within the time window. The MzArray of each scan is corrected, and
+// the precursor m/z values of MSn scans are corrected with the fit of the
+// preceding MS1 scan. The errors after the correction are only reported in
+// the returned CalibrationReport, and Instrument.Accuracy is left unchanged.
+//
+// Parameters:
+//   calibrants: The exact m/z values of the calibrant ions
+//   tolerance: The window in which to search for each calibrant
+//   model: The order of the fit, such as ConstantCalibration,
+//     LinearCalibration or QuadraticCalibration
+//   timeWindow: The width in minutes of the window of scans used for each
+//     fit, or 0 to fit each MS1 scan separately
+//
+// Return values:
+//   CalibrationReport: The errors of the calibrants before and after the
+//     correction
+//   error: An error if no calibrants were found
+func (r *RawData) Recalibrate(calibrants []float64, tolerance Tolerance,
+	model int, timeWindow float64) (CalibrationReport, error) {
+	report := CalibrationReport{}
+	matches := make([]calibrantMatch, 0)
+	ms1 := make([]int, 0)
+	for i := range r.Scans {
+		if r.Scans[i].MsLevel == 1 {
+			ms1 = append(ms1, i)
+			matches = append(matches, r.Scans[i].findCalibrants(i, calibrants,
+				tolerance)...)
+		}
+	}
+	if len(matches) == 0 {
+		return report, errors.New("No calibrants were found")
+	}
+	// find the fit of each MS1 scan
+	fits := make(map[int]*calibration)
+	start, end := 0, 0
+	for _, i := range ms1 {
+		rt := r.Scans[i].RetentionTime
+		for start < len(matches) &&
+			r.Scans[matches[start].scan].RetentionTime < rt-timeWindow/2 &&
+			matches[start].scan != i {
+			start++
+		}
+		if end < start {
+			end = start
+		}
+		for end < len(matches) &&
+			(r.Scans[matches[end].scan].RetentionTime <= rt+timeWindow/2 ||
+				matches[end].scan == i) {
+			end++
+		}
+		if fit := calibrationFit(matches[start:end], model); fit != nil {
+			fits[i] = fit
+		}
+	}
+	// correct the calibrants to measure the remaining error
+	after := make([]float64, 0, len(matches))
+	before := make([]float64, 0, len(matches))
+	for _, m := range matches {
+		before = append(before, ppmError(m.measured, m.expected))
+		if fit, ok := fits[m.scan]; ok {
+			after = append(after,
+				ppmError(calibrate(m.measured, fit), m.expected))
+		} else {
+			after = append(after, ppmError(m.measured, m.expected))
+		}
+	}
+	var fit *calibration
+	for i := range r.Scans {
+		s := &r.Scans[i]
+		if s.MsLevel == 1 {
+			fit = fits[i]
+		}
+		if fit == nil {
+			report.UncalibratedScans++
+			continue
+		}
+		report.CalibratedScans++
+		for j, v := range s.MzArray {
+			s.MzArray[j] = calibrate(v, fit)
+		}
+		if s.MsLevel > 1 {
+			if s.PrecursorMz != 0 {
+				s.PrecursorMz = calibrate(s.PrecursorMz, fit)
+			}
+			for j := range s.Precursors {
+				p := &s.Precursors[j]
+				if p.Mz != 0 {
+					p.Mz = calibrate(p.Mz, fit)
+				}
+				if p.IsolationTarget != 0 {
+					p.IsolationTarget = calibrate(p.IsolationTarget, fit)
+				}
+			}
+		}
+	}
+	report.Before = newPpmErrors(before)
+	report.After = newPpmErrors(after)
+	return report, nil
+}
+
+// Finds the most intense peak within the tolerance of each calibrant.
+func (s *Scan) findCalibrants(scan int, calibrants []float64,
+	tolerance Tolerance) []calibrantMatch {
+	mz, intensity := s.sortedPeaks()
+	matches := make([]calibrantMatch, 0, len(calibrants))
+	for _, c := range calibrants {
+		minMz, maxMz := tolerance.Range(c)
+		best := -1
+		for i := sort.SearchFloat64s(mz, minMz); i < len(mz) &&
+			mz[i] <= maxMz; i++ {
+			if best < 0 || intensity[i] > intensity[best] {
+				best = i
+			}
+		}
+		if best >= 0 {
+			matches = append(matches, calibrantMatch{scan, c, mz[best]})
+		}
+	}
+	return matches
+}
+
+// Fits the ppm error of the matches as a polynomial of the m/z value, using
+// a lower order if there are too few distinct calibrants. The m/z values are
+// centered on their mean and scaled by their range.
+//
+// Return value:
+//   *calibration: The fit, or nil if there are no matches
+func calibrationFit(matches []calibrantMatch, order int) *calibration {
+	if len(matches) == 0 {
+		return nil
+	}
+	distinct := make(map[float64]bool)
+	fit := &calibration{scale: 1}
+	minMz, maxMz := math.Inf(1), math.Inf(-1)
+	for _, m := range matches {
+		distinct[m.expected] = true
+		fit.center += m.measured / float64(len(matches))
+		minMz = math.Min(minMz, m.measured)
+		maxMz = math.Max(maxMz, m.measured)
+	}
+	if maxMz > minMz {
+		fit.scale = maxMz - minMz
+	}
+	x := make([]float64, len(matches))
+	y := make([]float64, len(matches))
+	for i, m := range matches {
+		x[i] = (m.measured - fit.center) / fit.scale
+		y[i] = ppmError(m.measured, m.expected)
+	}
+	if order >= len(distinct) {
+		order = len(distinct) - 1
+	}
+	for ; order >= 0; order-- {
+		coefficients, err := polynomialFit(x, y, 0, order)
+		if err == nil {
+			fit.coefficients = coefficients
+			return fit
+		}
+	}
+	return nil
+}
+
+// Corrects an m/z value using a fit of the ppm error.
+func calibrate(mz float64, fit *calibration) float64 {
+	x := (mz - fit.center) / fit.scale
+	ppm := 0.0
+	power := 1.0
+	for _, c := range fit.coefficients {
+		ppm += c * power
+		power *= x
+	}
+	return mz / (1 + ppm*1e-6)
+}
+
+// Returns the error in parts per million of a measured m/z value
+func ppmError(measured float64, expected float64) float64 {
+	return (measured - expected) / expected * 1e6
+}
+
+// Summarizes a set of ppm errors
+func newPpmErrors(errors []float64) PpmErrors {
+	stats := PpmErrors{Count: len(errors)}
+	if len(errors) == 0 {
+		return stats
+	}
+	stats.Mean, stats.StdDev = meanStdDev(errors)
+	stats.Median = median(errors)
+	var squares float64
+	for _, v := range errors {
+		squares += v * v
+		stats.Max = math.Max(stats.Max, math.Abs(v))
+	}
+	stats.Rms = math.Sqrt(squares / float64(len(errors)))
+	return stats
+}
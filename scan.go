@@ -15,25 +15,54 @@
 package mzlib
 
 import (
-	"fmt"
 	"math"
+	"sort"
 )
 
-// Represents a single scan in the mass spectrometry data.
+const (
+	// The mass difference between the carbon 13 and carbon 12 isotopes
+	IsotopeSpacing float64 = 1.00335
+	// The highest charge considered by DeIsotope
+	MaxIsotopeCharge int = 6
+)
+
+// Represents a single scan in the mass spectrometry data. The ParentScan and
+// Precursor* fields, IsolationWidth, ActivationMethod and CollisionEnergy
+// describe the first entry in Precursors, and are written in its place when
+// the scan is encoded. SpectrumType is the PSI-MS accession of the type of
+// spectrum, such as MS:1000582 for a SIM spectrum, or empty to derive it from
+// MsLevel. ScanParams holds any additional parameters of the individual scan
+// rather than the spectrum as a whole. IntensityFactor is the scale factor
+// applied to the intensities by normalization, or 0 if they have not been
+// normalized.
 type Scan struct {
 	RetentionTime      float64
 	Polarity           int8
 	MsLevel            uint8
 	Id                 uint64
+	ScanType           string
+	SpectrumType       string
+	FilterLine         string
 	MzRange            [2]float64
 	ParentScan         uint64
 	PrecursorMz        float64
 	PrecursorIntensity float64
+	PrecursorCharge    int8
+	IsolationWidth     float64
+	ActivationMethod   string
 	CollisionEnergy    float64
 	Continuous         bool
 	DeIsotoped         bool
+	Params             Params
+	ScanParams         Params
+	Precursors         []Precursor
+	Mobility           float64
+	MobilityUnit       string
+	IntensityFactor    float64
 	MzArray            []float64
 	IntensityArray     []float64
+	MobilityArray      []float64
+	ExtraArrays        []DataArray
 }
 
 func (s *Scan) Clone() *Scan {
@@ -42,13 +71,24 @@ func (s *Scan) Clone() *Scan {
 	cpy.Polarity = s.Polarity
 	cpy.MsLevel = s.MsLevel
 	cpy.Id = s.Id
+	cpy.ScanType = s.ScanType
+	cpy.SpectrumType = s.SpectrumType
+	cpy.FilterLine = s.FilterLine
 	cpy.MzRange = s.MzRange
 	cpy.ParentScan = s.ParentScan
 	cpy.PrecursorMz = s.PrecursorMz
 	cpy.PrecursorIntensity = s.PrecursorIntensity
+	cpy.PrecursorCharge = s.PrecursorCharge
+	cpy.IsolationWidth = s.IsolationWidth
+	cpy.ActivationMethod = s.ActivationMethod
 	cpy.CollisionEnergy = s.CollisionEnergy
 	cpy.Continuous = s.Continuous
 	cpy.DeIsotoped = s.DeIsotoped
+	cpy.Params = s.Params.Clone()
+	cpy.ScanParams = s.ScanParams.Clone()
+	for i := range s.Precursors {
+		cpy.Precursors = append(cpy.Precursors, s.Precursors[i].Clone())
+	}
 	cpy.MzArray = make([]float64, 0, len(s.MzArray))
 	cpy.IntensityArray = make([]float64, 0, len(s.IntensityArray))
 	for _, v := range s.MzArray {
@@ -57,6 +97,16 @@ func (s *Scan) Clone() *Scan {
 	for _, v := range s.IntensityArray {
 		cpy.IntensityArray = append(cpy.IntensityArray, v)
 	}
+	cpy.Mobility = s.Mobility
+	cpy.MobilityUnit = s.MobilityUnit
+	cpy.IntensityFactor = s.IntensityFactor
+	if s.MobilityArray != nil {
+		cpy.MobilityArray = make([]float64, len(s.MobilityArray))
+		copy(cpy.MobilityArray, s.MobilityArray)
+	}
+	for i := range s.ExtraArrays {
+		cpy.ExtraArrays = append(cpy.ExtraArrays, s.ExtraArrays[i].Clone())
+	}
 	return cpy
 }
 
@@ -111,20 +161,9 @@ func (s *Scan) PeakIntensity() float64 {
 // Return value:
 //   uint64: The number of peaks removed
 func (s *Scan) RemoveMz(minMz float64, maxMz float64) uint64 {
-	newMz := make([]float64, 0, len(s.MzArray))
-	newIntensity := make([]float64, 0, len(s.IntensityArray))
-	removed := uint64(0)
-	for i, v := range s.MzArray {
-		if v < minMz || v > maxMz {
-			newMz = append(newMz, v)
-			newIntensity = append(newIntensity, s.IntensityArray[i])
-		} else {
-			removed++
-		}
-	}
-	s.MzArray = newMz
-	s.IntensityArray = newIntensity
-	return removed
+	return s.keepPeaks(func(i int) bool {
+		return s.MzArray[i] < minMz || s.MzArray[i] > maxMz
+	})
 }
 
 // Removes any peaks outside the specified range
@@ -136,19 +175,51 @@ func (s *Scan) RemoveMz(minMz float64, maxMz float64) uint64 {
 // Return value:
 //   uint64: The number of peaks removed
 func (s *Scan) OnlyMz(minMz float64, maxMz float64) uint64 {
+	return s.keepPeaks(func(i int) bool {
+		return s.MzArray[i] > minMz && s.MzArray[i] < maxMz
+	})
+}
+
+// Removes peaks from the scan, keeping the MobilityArray and ExtraArrays
+// aligned with the MzArray and IntensityArray.
+//
+// Parameters:
+//   keep: A function returning whether or not the peak at the given index
+//     should be retained
+//
+// Return value:
+//   uint64: The number of peaks removed
+func (s *Scan) keepPeaks(keep func(i int) bool) uint64 {
 	newMz := make([]float64, 0, len(s.MzArray))
 	newIntensity := make([]float64, 0, len(s.IntensityArray))
+	var newMobility []float64
+	if s.MobilityArray != nil {
+		newMobility = make([]float64, 0, len(s.MobilityArray))
+	}
+	newExtra := make([][]float64, len(s.ExtraArrays))
 	removed := uint64(0)
 	for i, v := range s.MzArray {
-		if v > minMz && v < maxMz {
+		if keep(i) {
 			newMz = append(newMz, v)
 			newIntensity = append(newIntensity, s.IntensityArray[i])
+			if i < len(s.MobilityArray) {
+				newMobility = append(newMobility, s.MobilityArray[i])
+			}
+			for j := range s.ExtraArrays {
+				if i < len(s.ExtraArrays[j].Values) {
+					newExtra[j] = append(newExtra[j], s.ExtraArrays[j].Values[i])
+				}
+			}
 		} else {
 			removed++
 		}
 	}
 	s.MzArray = newMz
 	s.IntensityArray = newIntensity
+	s.MobilityArray = newMobility
+	for j := range s.ExtraArrays {
+		s.ExtraArrays[j].Values = newExtra[j]
+	}
 	return removed
 }
 
@@ -182,28 +253,250 @@ func (s *Scan) TotalIntensity() float64 {
 	return sum
 }
 
-// Centralizes the scan values, converting from continuous to discrete data
-//
-// This method is not yet implemented
+// Centralizes the scan values, converting from continuous to discrete data.
+// Each local maximum of the profile becomes a single peak, with the m/z
+// value of the apex interpolated from a gaussian fit of the three highest
+// points and the intensity summed over the points of the profile peak. The
+// MobilityArray and ExtraArrays hold the values at the highest point of each
+// peak afterwards.
 //
 // Parameters:
 //   accuracy: The accuracy of the instrument which collected the values. All
 //     m/z values within this range of the local peak intensity will be merged.
 func (s *Scan) Centralize(accuracy float64) {
-	fmt.Println("Scan.Centralize is not yet implemented")
-	// do something here
-	//  s.Continuous = false
+	mz, intensity := s.sortedPeaks()
+	order := make([]int, len(s.MzArray))
+	for i := range order {
+		order[i] = i
+	}
+	if !sort.Float64sAreSorted(s.MzArray) {
+		sort.Slice(order, func(i, j int) bool {
+			return s.MzArray[order[i]] < s.MzArray[order[j]]
+		})
+	}
+	type centroid struct {
+		mz, intensity, height float64
+		apex                  int
+	}
+	centroids := make([]centroid, 0)
+	for i := 0; i < len(mz); i++ {
+		if intensity[i] <= 0 || (i > 0 && intensity[i-1] > intensity[i]) {
+			continue
+		}
+		// include any plateau in the apex
+		top := i
+		for top+1 < len(mz) && intensity[top+1] == intensity[i] {
+			top++
+		}
+		if top+1 < len(mz) && intensity[top+1] > intensity[i] {
+			i = top
+			continue
+		}
+		start, end := i, top
+		for start > 0 && intensity[start-1] > 0 &&
+			intensity[start-1] < intensity[start] {
+			start--
+		}
+		for end+1 < len(mz) && intensity[end+1] > 0 &&
+			intensity[end+1] < intensity[end] {
+			end++
+		}
+		c := centroid{height: intensity[i], apex: (i + top) / 2}
+		for j := start; j <= end; j++ {
+			c.intensity += intensity[j]
+		}
+		if i == top && i > 0 && i+1 < len(mz) {
+			c.mz = gaussianApex(mz[i-1:i+2], intensity[i-1:i+2])
+		} else {
+			c.mz = (mz[i] + mz[top]) / 2
+		}
+		centroids = append(centroids, c)
+		i = end
+	}
+	if accuracy > 0 {
+		// merge peaks into more intense peaks within the accuracy
+		strongest := make([]int, len(centroids))
+		for i := range strongest {
+			strongest[i] = i
+		}
+		sort.SliceStable(strongest, func(i, j int) bool {
+			return centroids[strongest[i]].height >
+				centroids[strongest[j]].height
+		})
+		for _, i := range strongest {
+			if centroids[i].intensity == 0 {
+				continue
+			}
+			for j := i - 1; j >= 0 &&
+				centroids[i].mz-centroids[j].mz <= accuracy; j-- {
+				if centroids[j].height <= centroids[i].height {
+					centroids[i].intensity += centroids[j].intensity
+					centroids[j].intensity = 0
+				}
+			}
+			for j := i + 1; j < len(centroids) &&
+				centroids[j].mz-centroids[i].mz <= accuracy; j++ {
+				if centroids[j].height <= centroids[i].height {
+					centroids[i].intensity += centroids[j].intensity
+					centroids[j].intensity = 0
+				}
+			}
+		}
+	}
+	newMz := make([]float64, 0, len(centroids))
+	newIntensity := make([]float64, 0, len(centroids))
+	var newMobility []float64
+	if s.MobilityArray != nil {
+		newMobility = make([]float64, 0, len(centroids))
+	}
+	newExtra := make([][]float64, len(s.ExtraArrays))
+	for _, c := range centroids {
+		if c.intensity == 0 {
+			continue
+		}
+		newMz = append(newMz, c.mz)
+		newIntensity = append(newIntensity, c.intensity)
+		apex := order[c.apex]
+		if apex < len(s.MobilityArray) {
+			newMobility = append(newMobility, s.MobilityArray[apex])
+		}
+		for j := range s.ExtraArrays {
+			if apex < len(s.ExtraArrays[j].Values) {
+				newExtra[j] = append(newExtra[j], s.ExtraArrays[j].Values[apex])
+			}
+		}
+	}
+	s.MzArray = newMz
+	s.IntensityArray = newIntensity
+	s.MobilityArray = newMobility
+	for j := range s.ExtraArrays {
+		s.ExtraArrays[j].Values = newExtra[j]
+	}
+	s.Continuous = false
 }
 
-// DeIsotopes the scan, combining all isotopic peaks into the main peak.
+// Finds the apex of a peak by fitting a gaussian to three points around the
+// local maximum. The middle point is returned if no fit is possible.
+//
+// Parameters:
+//   mz: The m/z values of the three points
+//   intensity: The intensity values of the three points
 //
-// This method is not yet implemented
+// Return value:
+//   float64: The m/z value of the apex
+func gaussianApex(mz []float64, intensity []float64) float64 {
+	if intensity[0] <= 0 || intensity[2] <= 0 {
+		return mz[1]
+	}
+	x0, x1, x2 := mz[0], mz[1], mz[2]
+	y0, y1, y2 := math.Log(intensity[0]), math.Log(intensity[1]),
+		math.Log(intensity[2])
+	denom := (x0 - x1) * (x0 - x2) * (x1 - x2)
+	a := (x2*(y1-y0) + x1*(y0-y2) + x0*(y2-y1)) / denom
+	b := (x2*x2*(y0-y1) + x1*x1*(y2-y0) + x0*x0*(y1-y2)) / denom
+	if a >= 0 || math.IsNaN(a) || math.IsInf(a, 0) {
+		return mz[1]
+	}
+	apex := -b / (2 * a)
+	if apex < x0 || apex > x2 {
+		return mz[1]
+	}
+	return apex
+}
+
+// DeIsotopes the scan, combining all isotopic peaks into the main peak.
+// Isotope envelopes are found as series of peaks spaced by IsotopeSpacing/z
+// for charges from 1 to MaxIsotopeCharge. Each envelope is replaced by its
+// monoisotopic peak with the summed intensity of the envelope, and the charge
+// of every remaining peak is recorded in a ChargeArray, with 0 for peaks
+// which are not part of an envelope.
 //
 // Parameters:
 //   accuracy: The accuracy of the instrument which collected the values. All
 //     m/z values within this range of the local peak intensity will be merged.
 func (s *Scan) DeIsotope(accuracy float64) {
-	fmt.Println("Scan.DeIsotope is not yet implemented")
-	// do something here
-	//  s.DeIsotoped = true
+	order := make([]int, len(s.MzArray))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return s.MzArray[order[i]] < s.MzArray[order[j]]
+	})
+	used := make([]bool, len(order))
+	charges := make([]float64, len(s.MzArray))
+	intensities := make([]float64, len(s.IntensityArray))
+	copy(intensities, s.IntensityArray)
+	for i := range order {
+		if used[i] {
+			continue
+		}
+		var envelope []int
+		charge := 0
+		for z := 1; z <= MaxIsotopeCharge; z++ {
+			series := s.isotopeSeries(order, used, i, float64(z), accuracy)
+			if len(series) > len(envelope) {
+				envelope, charge = series, z
+			}
+		}
+		if len(envelope) < 2 {
+			continue
+		}
+		mono := order[i]
+		charges[mono] = float64(charge)
+		for _, j := range envelope[1:] {
+			used[j] = true
+			intensities[mono] += s.IntensityArray[order[j]]
+		}
+	}
+	s.IntensityArray = intensities
+	s.SetExtraArray(NewDataArray(ChargeArray, charges))
+	removed := make([]bool, len(s.MzArray))
+	for i, v := range order {
+		removed[v] = used[i]
+	}
+	s.keepPeaks(func(i int) bool {
+		return !removed[i]
+	})
+	s.DeIsotoped = true
+}
+
+// Finds the peaks of an isotope envelope of the given charge starting with
+// a monoisotopic peak. Each isotope peak after the first must be less intense
+// than either the monoisotopic peak or the previous isotope peak.
+//
+// Parameters:
+//   order: The indices of the peaks sorted by m/z
+//   used: Whether or not each entry in order already belongs to an envelope
+//   start: The position in order of the monoisotopic peak
+//   charge: The charge of the envelope
+//   accuracy: The maximum deviation in m/z of each isotope peak
+//
+// Return value:
+//   []int: The positions in order of the peaks in the envelope, starting
+//     with the monoisotopic peak
+func (s *Scan) isotopeSeries(order []int, used []bool, start int,
+	charge float64, accuracy float64) []int {
+	series := []int{start}
+	last := start
+	for {
+		target := s.MzArray[order[last]] + IsotopeSpacing/charge
+		next := -1
+		for j := last + 1; j < len(order) &&
+			s.MzArray[order[j]] <= target+accuracy; j++ {
+			if used[j] || s.MzArray[order[j]] < target-accuracy {
+				continue
+			}
+			if next < 0 || math.Abs(s.MzArray[order[j]]-target) <
+				math.Abs(s.MzArray[order[next]]-target) {
+				next = j
+			}
+		}
+		if next < 0 || (len(series) > 1 &&
+			s.IntensityArray[order[next]] > s.IntensityArray[order[last]] &&
+			s.IntensityArray[order[next]] > s.IntensityArray[order[start]]) {
+			return series
+		}
+		series = append(series, next)
+		last = next
+	}
 }
@@ -0,0 +1,246 @@
+//  Copyright 2013 Thomas McGrew
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package mzlib
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	// The transforms which may be applied to intensities before comparing
+	// scans.
+	NoTransform int = iota
+	SqrtTransform
+	LogTransform
+)
+
+// A pair of matching peaks in two scans, as indices into the MzArray of each
+type PeakMatch struct {
+	Index      int
+	OtherIndex int
+}
+
+// The result of comparing two scans
+type Similarity struct {
+	Score   float64
+	Matches []PeakMatch
+}
+
+// Calculates the cosine similarity of two scans. Each peak is matched to at
+// most one peak in the other scan, with the pairs with the highest product of
+// intensities matched first.
+//
+// Parameters:
+//   other: The scan to compare to
+//   tolerance: The tolerance for matching peaks
+//   transform: NoTransform, SqrtTransform or LogTransform, which is applied
+//     to the intensities before comparing
+//
+// Return value:
+//   Similarity: The score, from 0 to 1, and the matched peaks
+func (s *Scan) Cosine(other *Scan, tolerance Tolerance,
+	transform int) Similarity {
+	return s.cosine(other, tolerance, transform, 0)
+}
+
+// Calculates the modified cosine similarity of two scans, which also matches
+// peaks shifted by the difference between the precursor m/z values of the
+// scans, so that fragments containing a modification still match.
+//
+// Parameters:
+//   other: The scan to compare to
+//   tolerance: The tolerance for matching peaks
+//   transform: NoTransform, SqrtTransform or LogTransform, which is applied
+//     to the intensities before comparing
+//
+// Return value:
+//   Similarity: The score, from 0 to 1, and the matched peaks
+func (s *Scan) ModifiedCosine(other *Scan, tolerance Tolerance,
+	transform int) Similarity {
+	shift := 0.0
+	a, b := s.precursors(), other.precursors()
+	if len(a) > 0 && len(b) > 0 {
+		shift = b[0].Mz - a[0].Mz
+	}
+	return s.cosine(other, tolerance, transform, shift)
+}
+
+// Calculates the entropy similarity of two scans, as described by Li et al.
+// (2021). The intensities of each scan are scaled to a total of 1, and the
+// intensities of scans with a spectral entropy below 3 are weighted to
+// increase their entropy.
+//
+// Parameters:
+//   other: The scan to compare to
+//   tolerance: The tolerance for matching peaks
+//
+// Return value:
+//   Similarity: The score, from 0 to 1, and the matched peaks
+func (s *Scan) EntropySimilarity(other *Scan,
+	tolerance Tolerance) Similarity {
+	a := entropyWeighted(s.IntensityArray)
+	b := entropyWeighted(other.IntensityArray)
+	matches := matchPeaks(s.MzArray, a, other.MzArray, b, tolerance, 0)
+	score := 0.0
+	for _, m := range matches {
+		x, y := a[m.Index], b[m.OtherIndex]
+		score += (x+y)*math.Log2(x+y) - x*math.Log2(x) - y*math.Log2(y)
+	}
+	return Similarity{math.Min(score/2, 1), matches}
+}
+
+// Calculates the cosine similarity of two scans, also matching peaks shifted
+// by the given m/z difference if it is not 0.
+func (s *Scan) cosine(other *Scan, tolerance Tolerance, transform int,
+	shift float64) Similarity {
+	a := transformIntensity(s.IntensityArray, transform)
+	b := transformIntensity(other.IntensityArray, transform)
+	matches := matchPeaks(s.MzArray, a, other.MzArray, b, tolerance, shift)
+	var product, normA, normB float64
+	for _, m := range matches {
+		product += a[m.Index] * b[m.OtherIndex]
+	}
+	for _, v := range a {
+		normA += v * v
+	}
+	for _, v := range b {
+		normB += v * v
+	}
+	if normA == 0 || normB == 0 {
+		return Similarity{0, matches}
+	}
+	return Similarity{math.Min(product/math.Sqrt(normA*normB), 1), matches}
+}
+
+// Matches the peaks of two scans, so each peak is matched to at most one
+// other peak, matching the pairs with the highest product of intensities
+// first.
+//
+// Parameters:
+//   mzA, a: The m/z values and intensities of the first scan
+//   mzB, b: The m/z values and intensities of the second scan
+//   tolerance: The tolerance for matching peaks
+//   shift: An m/z difference to also match peaks of the second scan at, or
+//     0 to only match peaks at the same m/z
+//
+// Return value:
+//   []PeakMatch: The matched peaks, sorted by the index in the first scan
+func matchPeaks(mzA []float64, a []float64, mzB []float64, b []float64,
+	tolerance Tolerance, shift float64) []PeakMatch {
+	orderB := make([]int, len(mzB))
+	for i := range orderB {
+		orderB[i] = i
+	}
+	sort.Slice(orderB, func(i, j int) bool {
+		return mzB[orderB[i]] < mzB[orderB[j]]
+	})
+	type candidate struct {
+		i, j    int
+		product float64
+	}
+	candidates := make([]candidate, 0)
+	shifts := []float64{0}
+	if shift != 0 {
+		shifts = append(shifts, shift)
+	}
+	for i, mz := range mzA {
+		if a[i] <= 0 {
+			continue
+		}
+		for _, d := range shifts {
+			minMz, maxMz := tolerance.Range(mz + d)
+			k := sort.Search(len(orderB), func(k int) bool {
+				return mzB[orderB[k]] >= minMz
+			})
+			for ; k < len(orderB) && mzB[orderB[k]] <= maxMz; k++ {
+				if j := orderB[k]; b[j] > 0 {
+					candidates = append(candidates, candidate{i, j, a[i] * b[j]})
+				}
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].product > candidates[j].product
+	})
+	usedA := make(map[int]bool)
+	usedB := make(map[int]bool)
+	matches := make([]PeakMatch, 0)
+	for _, c := range candidates {
+		if !usedA[c.i] && !usedB[c.j] {
+			usedA[c.i], usedB[c.j] = true, true
+			matches = append(matches, PeakMatch{c.i, c.j})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].Index < matches[j].Index
+	})
+	return matches
+}
+
+// Applies an intensity transform, clipping negative intensities to 0
+func transformIntensity(intensity []float64, transform int) []float64 {
+	transformed := make([]float64, len(intensity))
+	for i, v := range intensity {
+		v = math.Max(v, 0)
+		switch transform {
+		case SqrtTransform:
+			v = math.Sqrt(v)
+		case LogTransform:
+			v = math.Log1p(v)
+		}
+		transformed[i] = v
+	}
+	return transformed
+}
+
+// Scales the intensities to a total of 1, weighting them to increase the
+// spectral entropy if it is below 3.
+func entropyWeighted(intensity []float64) []float64 {
+	weighted := make([]float64, len(intensity))
+	copy(weighted, intensity)
+	scaleToTotal(weighted)
+	entropy := 0.0
+	for _, v := range weighted {
+		if v > 0 {
+			entropy -= v * math.Log(v)
+		}
+	}
+	if entropy < 3 {
+		weight := 0.25 + 0.25*entropy
+		for i, v := range weighted {
+			weighted[i] = math.Pow(v, weight)
+		}
+		scaleToTotal(weighted)
+	}
+	return weighted
+}
+
+// Scales positive values to a total of 1, setting other values to 0
+func scaleToTotal(values []float64) {
+	var total float64
+	for i, v := range values {
+		if v > 0 {
+			total += v
+		} else {
+			values[i] = 0
+		}
+	}
+	if total > 0 {
+		for i := range values {
+			values[i] /= total
+		}
+	}
+}
@@ -0,0 +1,315 @@
+//  Copyright 2013 Thomas McGrew
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package mzlib
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Smooths a signal with a Savitzky-Golay filter. A polynomial is fit by
+// least squares to the points around each point using their actual x
+// values, so unevenly spaced data is handled correctly.
+//
+// Parameters:
+//   x: The x values of the signal, such as m/z or retention time, or nil for
+//     evenly spaced values
+//   y: The y values of the signal
+//   window: The number of points to fit each polynomial to
+//   order: The order of the polynomial
+//
+// Return values:
+//   []float64: The smoothed y values
+//   error: An error if the window is smaller than 1
+func SavitzkyGolay(x []float64, y []float64, window int,
+	order int) ([]float64, error) {
+	if err := checkWindow(window); err != nil {
+		return nil, err
+	}
+	x = smoothX(x, len(y))
+	smoothed := make([]float64, len(y))
+	for i := range y {
+		start, end := smoothWindow(i, len(y), window)
+		coefficients, err := polynomialFit(x[start:end], y[start:end], x[i],
+			order)
+		if err != nil {
+			smoothed[i] = y[i]
+		} else {
+			smoothed[i] = coefficients[0]
+		}
+	}
+	return smoothed, nil
+}
+
+// Smooths a signal with a gaussian filter. The weight of each point is based
+// on its distance in x from the point being smoothed, with a standard
+// deviation of half the distance to the furthest point in the window.
+//
+// Parameters:
+//   x: The x values of the signal, such as m/z or retention time, or nil for
+//     evenly spaced values
+//   y: The y values of the signal
+//   window: The number of points in the window
+//
+// Return values:
+//   []float64: The smoothed y values
+//   error: An error if the window is smaller than 1
+func GaussianSmooth(x []float64, y []float64,
+	window int) ([]float64, error) {
+	if err := checkWindow(window); err != nil {
+		return nil, err
+	}
+	x = smoothX(x, len(y))
+	smoothed := make([]float64, len(y))
+	half := window / 2
+	for i := range y {
+		start, end := i-half, i+half+1
+		if start < 0 {
+			start = 0
+		}
+		if end > len(y) {
+			end = len(y)
+		}
+		width := math.Max(x[i]-x[start], x[end-1]-x[i])
+		sigma := width / 2
+		if sigma <= 0 {
+			smoothed[i] = y[i]
+			continue
+		}
+		var sum, weights float64
+		for j := start; j < end; j++ {
+			d := (x[j] - x[i]) / sigma
+			w := math.Exp(-d * d / 2)
+			sum += w * y[j]
+			weights += w
+		}
+		smoothed[i] = sum / weights
+	}
+	return smoothed, nil
+}
+
+// Smooths a signal with a moving average. Each point is weighted by the
+// x range it covers, so unevenly spaced data is handled correctly.
+//
+// Parameters:
+//   x: The x values of the signal, such as m/z or retention time, or nil for
+//     evenly spaced values
+//   y: The y values of the signal
+//   window: The number of points in the window
+//
+// Return values:
+//   []float64: The smoothed y values
+//   error: An error if the window is smaller than 1
+func MovingAverage(x []float64, y []float64,
+	window int) ([]float64, error) {
+	if err := checkWindow(window); err != nil {
+		return nil, err
+	}
+	x = smoothX(x, len(y))
+	smoothed := make([]float64, len(y))
+	half := window / 2
+	for i := range y {
+		start, end := i-half, i+half+1
+		if start < 0 {
+			start = 0
+		}
+		if end > len(y) {
+			end = len(y)
+		}
+		var sum, weights float64
+		for j := start; j < end; j++ {
+			w := 1.0
+			if end-start > 1 {
+				lower, upper := x[j], x[j]
+				if j > start {
+					lower = (x[j-1] + x[j]) / 2
+				}
+				if j < end-1 {
+					upper = (x[j] + x[j+1]) / 2
+				}
+				w = upper - lower
+			}
+			sum += w * y[j]
+			weights += w
+		}
+		if weights > 0 {
+			smoothed[i] = sum / weights
+		} else {
+			smoothed[i] = y[i]
+		}
+	}
+	return smoothed, nil
+}
+
+// Returns a copy of the scan with the intensity values smoothed by a
+// Savitzky-Golay filter.
+//
+// Parameters:
+//   window: The number of points to fit each polynomial to
+//   order: The order of the polynomial
+//
+// Return values:
+//   *Scan: The smoothed scan
+//   error: An error if the window is smaller than 1
+func (s *Scan) SavitzkyGolay(window int, order int) (*Scan, error) {
+	smoothed, err := SavitzkyGolay(s.MzArray, s.IntensityArray, window,
+		order)
+	if err != nil {
+		return nil, err
+	}
+	cpy := s.Clone()
+	cpy.IntensityArray = smoothed
+	return cpy, nil
+}
+
+// Returns a copy of the scan with the intensity values smoothed by a
+// gaussian filter.
+//
+// Parameters:
+//   window: The number of points in the window
+//
+// Return values:
+//   *Scan: The smoothed scan
+//   error: An error if the window is smaller than 1
+func (s *Scan) GaussianSmooth(window int) (*Scan, error) {
+	smoothed, err := GaussianSmooth(s.MzArray, s.IntensityArray, window)
+	if err != nil {
+		return nil, err
+	}
+	cpy := s.Clone()
+	cpy.IntensityArray = smoothed
+	return cpy, nil
+}
+
+// Returns a copy of the scan with the intensity values smoothed by a moving
+// average.
+//
+// Parameters:
+//   window: The number of points in the window
+//
+// Return values:
+//   *Scan: The smoothed scan
+//   error: An error if the window is smaller than 1
+func (s *Scan) MovingAverage(window int) (*Scan, error) {
+	smoothed, err := MovingAverage(s.MzArray, s.IntensityArray, window)
+	if err != nil {
+		return nil, err
+	}
+	cpy := s.Clone()
+	cpy.IntensityArray = smoothed
+	return cpy, nil
+}
+
+// Returns a copy of the chromatogram with the intensity values smoothed by a
+// Savitzky-Golay filter.
+//
+// Parameters:
+//   window: The number of points to fit each polynomial to
+//   order: The order of the polynomial
+//
+// Return values:
+//   *Chromatogram: The smoothed chromatogram
+//   error: An error if the window is smaller than 1
+func (c *Chromatogram) SavitzkyGolay(window int,
+	order int) (*Chromatogram, error) {
+	smoothed, err := SavitzkyGolay(c.TimeArray, c.IntensityArray, window,
+		order)
+	if err != nil {
+		return nil, err
+	}
+	cpy := c.Clone()
+	cpy.IntensityArray = smoothed
+	return cpy, nil
+}
+
+// Returns a copy of the chromatogram with the intensity values smoothed by a
+// gaussian filter.
+//
+// Parameters:
+//   window: The number of points in the window
+//
+// Return values:
+//   *Chromatogram: The smoothed chromatogram
+//   error: An error if the window is smaller than 1
+func (c *Chromatogram) GaussianSmooth(window int) (*Chromatogram, error) {
+	smoothed, err := GaussianSmooth(c.TimeArray, c.IntensityArray, window)
+	if err != nil {
+		return nil, err
+	}
+	cpy := c.Clone()
+	cpy.IntensityArray = smoothed
+	return cpy, nil
+}
+
+// Returns a copy of the chromatogram with the intensity values smoothed by a
+// moving average.
+//
+// Parameters:
+//   window: The number of points in the window
+//
+// Return values:
+//   *Chromatogram: The smoothed chromatogram
+//   error: An error if the window is smaller than 1
+func (c *Chromatogram) MovingAverage(window int) (*Chromatogram, error) {
+	smoothed, err := MovingAverage(c.TimeArray, c.IntensityArray, window)
+	if err != nil {
+		return nil, err
+	}
+	cpy := c.Clone()
+	cpy.IntensityArray = smoothed
+	return cpy, nil
+}
+
+// Checks that a smoothing window contains at least one point
+func checkWindow(window int) error {
+	if window < 1 {
+		return errors.New(fmt.Sprintf("Invalid window size %d", window))
+	}
+	return nil
+}
+
+// Returns the x values to use for smoothing, generating evenly spaced values
+// if x is nil.
+func smoothX(x []float64, length int) []float64 {
+	if len(x) >= length {
+		return x
+	}
+	x = make([]float64, length)
+	for i := range x {
+		x[i] = float64(i)
+	}
+	return x
+}
+
+// Returns the range of points in a window around a point. Windows at the
+// ends of the data are shifted to keep the same number of points.
+//
+// Return values:
+//   int: The first point in the window
+//   int: The end of the window (exclusive)
+func smoothWindow(i int, length int, window int) (int, int) {
+	if window > length {
+		window = length
+	}
+	start := i - window/2
+	if start < 0 {
+		start = 0
+	}
+	if start+window > length {
+		start = length - window
+	}
+	return start, start + window
+}
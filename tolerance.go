@@ -0,0 +1,99 @@
+//  Copyright 2013 Thomas McGrew
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package mzlib
+
+import (
+	"fmt"
+)
+
+// Represents an m/z tolerance, either in parts per million of the m/z value
+// or as an absolute value in Daltons.
+type Tolerance struct {
+	Value float64
+	Ppm   bool
+}
+
+// Creates a Tolerance in parts per million
+//
+// Parameters:
+//   ppm: The tolerance in parts per million
+//
+// Return value:
+//   Tolerance: The new Tolerance
+func Ppm(ppm float64) Tolerance {
+	return Tolerance{ppm, true}
+}
+
+// Creates an absolute Tolerance in Daltons
+//
+// Parameters:
+//   da: The tolerance in Daltons
+//
+// Return value:
+//   Tolerance: The new Tolerance
+func Da(da float64) Tolerance {
+	return Tolerance{da, false}
+}
+
+// Returns the absolute tolerance in Daltons at the given m/z value
+//
+// Parameters:
+//   mz: The m/z value
+//
+// Return value:
+//   float64: The tolerance in Daltons
+func (t Tolerance) Delta(mz float64) float64 {
+	if t.Ppm {
+		if mz < 0 {
+			mz = -mz
+		}
+		return mz * t.Value * 1e-6
+	}
+	return t.Value
+}
+
+// Returns the range of m/z values within the tolerance of the given m/z value
+//
+// Parameters:
+//   mz: The m/z value
+//
+// Return values:
+//   float64: The minimum m/z value within the tolerance
+//   float64: The maximum m/z value within the tolerance
+func (t Tolerance) Range(mz float64) (float64, float64) {
+	delta := t.Delta(mz)
+	return mz - delta, mz + delta
+}
+
+// Determines whether or not two m/z values are within the tolerance of each
+// other, using the first value as the reference for ppm tolerances.
+//
+// Parameters:
+//   mz: The reference m/z value
+//   other: The m/z value to compare
+//
+// Return value:
+//   bool: Whether or not the values match
+func (t Tolerance) Matches(mz float64, other float64) bool {
+	minMz, maxMz := t.Range(mz)
+	return other >= minMz && other <= maxMz
+}
+
+func (t Tolerance) String() string {
+	if t.Ppm {
+		return fmt.Sprintf("%g ppm", t.Value)
+	}
+	return fmt.Sprintf("%g Da", t.Value)
+}
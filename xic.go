@@ -0,0 +1,106 @@
+//  Copyright 2013 Thomas McGrew
+//
+//   Licensed under the Apache License, Version 2.0 (the "License");
+//   you may not use this file except in compliance with the License.
+//   You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+//   Unless required by applicable law or agreed to in writing, software
+//   distributed under the License is distributed on an "AS IS" BASIS,
+//   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//   See the License for the specific language governing permissions and
+//   limitations under the License.
+
+package mzlib
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Describes an ion to extract a chromatogram for. If MinTime and MaxTime are
+// both 0, the whole run is used.
+type XicTarget struct {
+	Id        string
+	Mz        float64
+	Tolerance Tolerance
+	MinTime   float64
+	MaxTime   float64
+}
+
+// Returns an extracted ion chromatogram for each of the targets. The scans
+// are read in a single pass, and peaks are located by a binary search of the
+// m/z values of each scan, so many targets can be extracted at once. Unlike
+// ExtractedIonChromatogram, the m/z bounds are inclusive.
+//
+// Parameters:
+//   targets: The ions to extract. The Id of each Chromatogram is the Id of
+//     the target, or the m/z value of the target if the Id is empty.
+//   msLevel: The ms level of the scans to include.
+//   polarity: The polarity of the scans to include, or 0 for any polarity.
+//
+// Return value:
+//   []Chromatogram: A chromatogram for each target, in the same order, with
+//     a point for each matching scan inside the retention time window of the
+//     target.
+func (r *RawData) ExtractedIonChromatograms(targets []XicTarget,
+	msLevel uint8, polarity int8) []Chromatogram {
+	chromatograms := make([]Chromatogram, len(targets))
+	for i, t := range targets {
+		c := &chromatograms[i]
+		c.Type = SicChromatogram
+		c.MsLevel = msLevel
+		c.Polarity = polarity
+		c.MzRange[0], c.MzRange[1] = t.Tolerance.Range(t.Mz)
+		c.Id = t.Id
+		if c.Id == "" {
+			c.Id = fmt.Sprintf("SIC m/z=%f", t.Mz)
+		}
+	}
+	var mz, intensity []float64
+	for i := range r.Scans {
+		s := &r.Scans[i]
+		if !s.matches(msLevel, polarity) {
+			continue
+		}
+		mz, intensity = s.sortedPeaks()
+		for j, t := range targets {
+			if (t.MinTime != 0 || t.MaxTime != 0) &&
+				(s.RetentionTime < t.MinTime || s.RetentionTime > t.MaxTime) {
+				continue
+			}
+			c := &chromatograms[j]
+			sum := 0.0
+			for k := sort.SearchFloat64s(mz, c.MzRange[0]); k < len(mz) &&
+				mz[k] <= c.MzRange[1]; k++ {
+				sum += intensity[k]
+			}
+			c.TimeArray = append(c.TimeArray, s.RetentionTime)
+			c.IntensityArray = append(c.IntensityArray, sum)
+		}
+	}
+	return chromatograms
+}
+
+// Returns the m/z and intensity values of the scan sorted by m/z. The arrays
+// of the scan are returned as they are if they are already sorted.
+func (s *Scan) sortedPeaks() ([]float64, []float64) {
+	if sort.Float64sAreSorted(s.MzArray) {
+		return s.MzArray, s.IntensityArray
+	}
+	order := make([]int, len(s.MzArray))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return s.MzArray[order[i]] < s.MzArray[order[j]]
+	})
+	mz := make([]float64, len(order))
+	intensity := make([]float64, len(order))
+	for i, v := range order {
+		mz[i] = s.MzArray[v]
+		intensity[i] = s.IntensityArray[v]
+	}
+	return mz, intensity
+}